@@ -4,9 +4,13 @@
 // instead of the default 5. Use the strconv.Atoi function to convert the string
 // parameter into an integer.
 // You can see its documentation with go doc strconv.Atoi.
+//
+// This version unpacks every parameter of the animation with
+// gopl.io/ch12/params, and can also draw harmonographs and spirographs.
 package main
 
 import (
+	"fmt"
 	"image"
 	"image/color"
 	"image/gif"
@@ -16,67 +20,176 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopl.io/ch12/params"
 )
 
-var palette = []color.Color{color.White, color.Black}
+// options are the parameters of an animation.
+type options struct {
+	Cycles float64  `http:"cycles"` // number of complete x oscillator revolutions
+	Res    float64  `http:"res"`    // angular resolution
+	Size   int      `http:"size"`   // image canvas covers [-size..+size]
+	Frames int      `http:"frames"` // number of animation frames
+	Delay  int      `http:"delay"`  // delay between frames in 10ms units
+	Colors []string `http:"color"`  // background, then line colors as RRGGBB
+	Curve  string   `http:"curve"`  // lissajous, harmonograph or spirograph
+	Seed   int      `http:"seed"`   // seed for the random frequencies; 0 means random
+}
+
+var defaults = options{
+	Cycles: 5,
+	Res:    0.001,
+	Size:   100,
+	Frames: 64,
+	Delay:  8,
+	Curve:  "lissajous",
+}
+
+// defaultColors is the palette used when no color parameters are given.
+var defaultColors = []string{"ffffff", "000000"}
 
 const (
-	whiteIndex = 0 // first color in palette
-	blackIndex = 1 // next color in palette
+	maxPoints = 10000000  // limit on points plotted per frame
+	maxPixels = 100000000 // limit on pixels of all frames together
 )
 
 func main() {
 	handler := func(w http.ResponseWriter, r *http.Request) {
-		if err := r.ParseForm(); err != nil {
-			log.Print(err)
+		opts := defaults
+		if err := params.Unpack(r, &opts); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest) // 400
+			return
 		}
-
-		var cyc int
-		cycles := r.Form.Get("cycles")
-		if cycles != "" {
-			var err error
-			cyc, err = strconv.Atoi(cycles)
-			if err != nil {
-				log.Print(err)
-			}
+		palette, err := opts.check()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest) // 400
+			return
+		}
+		w.Header().Set("Content-Type", "image/gif")
+		if err := lissajous(w, opts, palette); err != nil {
+			log.Print(err)
 		}
-		lissajous(w, cyc)
 	}
 	http.HandleFunc("/lissajous", handler)
 	log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
 
-// Lissajous generates GIF animations of random Lissajous figures.
-func lissajous(out io.Writer, cyc int) {
-	const (
-		cycles  = 5     // number of complete x oscillator revolutions
-		res     = 0.001 // angular resolution
-		size    = 100   // image canvas covers [-size..+size]
-		nframes = 64    // number of animation frames
-		delay   = 8     // delay between frames in 10ms units
-	)
-
-	var ncycles float64
-	if cyc > 0 {
-		ncycles = float64(cyc)
-	} else {
-		ncycles = cycles
+// check reports whether opts describes a reasonable animation,
+// and returns its palette.
+func (opts *options) check() (color.Palette, error) {
+	switch {
+	case opts.Cycles <= 0:
+		return nil, fmt.Errorf("cycles: must be positive")
+	case opts.Res <= 0 || opts.Cycles*2*math.Pi/opts.Res > maxPoints:
+		return nil, fmt.Errorf("res: too fine for %g cycles", opts.Cycles)
+	case opts.Size < 1 || opts.Size > 1000:
+		return nil, fmt.Errorf("size: %d out of range [1, 1000]", opts.Size)
+	case opts.Frames < 1 || opts.Frames > 500:
+		return nil, fmt.Errorf("frames: %d out of range [1, 500]", opts.Frames)
+	case opts.Frames*(2*opts.Size+1)*(2*opts.Size+1) > maxPixels:
+		return nil, fmt.Errorf("frames: %d too many for size %d", opts.Frames, opts.Size)
+	case opts.Delay < 0:
+		return nil, fmt.Errorf("delay: must not be negative")
+	}
+	if _, ok := curves[opts.Curve]; !ok {
+		return nil, fmt.Errorf("curve: unknown curve %q", opts.Curve)
+	}
+	colors := opts.Colors
+	if len(colors) == 0 {
+		colors = defaultColors
+	}
+	if len(colors) < 2 || len(colors) > 256 {
+		return nil, fmt.Errorf("color: need 2 to 256 colors, got %d", len(colors))
+	}
+	var palette color.Palette
+	for _, c := range colors {
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(c, "#"), 16, 32)
+		if err != nil || len(strings.TrimPrefix(c, "#")) != 6 {
+			return nil, fmt.Errorf("color: bad color %q; want RRGGBB", c)
+		}
+		palette = append(palette, color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255})
+	}
+	return palette, nil
+}
+
+// A curve returns the point at time t of a figure whose shape is
+// determined by the random frequencies freq, and which changes from
+// frame to frame with phase. Points lie within [-1, +1].
+type curve func(t float64, freq [2]float64, phase float64) (x, y float64)
+
+var curves = map[string]curve{
+	"lissajous":    lissajousCurve,
+	"harmonograph": harmonograph,
+	"spirograph":   spirograph,
+}
+
+func lissajousCurve(t float64, freq [2]float64, phase float64) (x, y float64) {
+	x = math.Sin(t)
+	y = math.Sin(t*freq[0] + phase)
+	return x, y
+}
+
+// harmonograph models two damped pendulums moving the pen along each axis.
+func harmonograph(t float64, freq [2]float64, phase float64) (x, y float64) {
+	const damping = 0.02
+	decay := math.Exp(-damping*t) / 2
+	x = (math.Sin(t) + math.Sin(t*freq[0]+phase)) * decay
+	y = (math.Sin(t*freq[1]+math.Pi/2) + math.Sin(t*(freq[0]+freq[1])/2+phase)) * decay
+	return x, y
+}
+
+// spirograph draws a hypotrochoid: the path of a pen at distance d from
+// the center of a circle of radius r rolling inside a circle of radius 1.
+func spirograph(t float64, freq [2]float64, phase float64) (x, y float64) {
+	r := 0.1 + freq[0]/3.75 // in [0.1, 0.9)
+	d := r * (0.5 + freq[1]/6) * (1 + math.Sin(phase)/4)
+	k := (1 - r) / r
+	x = ((1-r)*math.Cos(t) + d*math.Cos(k*t)) / (1 - r + d)
+	y = ((1-r)*math.Sin(t) - d*math.Sin(k*t)) / (1 - r + d)
+	return x, y
+}
+
+// Lissajous generates GIF animations of random Lissajous figures, or of
+// the other curves. The first color of palette is the background; the
+// figure is drawn in each of the others in turn, one per frame.
+func lissajous(out io.Writer, opts options, palette color.Palette) error {
+	seed := int64(opts.Seed)
+	if seed == 0 {
+		seed = time.Now().UnixNano()
 	}
+	rng := rand.New(rand.NewSource(seed))
+	// relative frequencies of the oscillators
+	freq := [2]float64{rng.Float64() * 3.0, rng.Float64() * 3.0}
 
-	freq := rand.Float64() * 3.0 // relative frequency of y oscillator
-	anim := gif.GIF{LoopCount: nframes}
+	plot := curves[opts.Curve]
+	size := float64(opts.Size)
+	anim := gif.GIF{LoopCount: opts.Frames}
 	phase := 0.0 // phase difference
-	for i := 0; i < nframes; i++ {
-		rect := image.Rect(0, 0, 2*size+1, 2*size+1)
+	for i := 0; i < opts.Frames; i++ {
+		rect := image.Rect(0, 0, 2*opts.Size+1, 2*opts.Size+1)
 		img := image.NewPaletted(rect, palette)
-		for t := 0.0; t < ncycles*2*math.Pi; t += res {
-			x := math.Sin(t)
-			y := math.Sin(t*freq + phase)
-			img.SetColorIndex(size+int(x*size+0.5), size+int(y*size+0.5), blackIndex)
+		index := uint8(1 + i%(len(palette)-1))
+		for t := 0.0; t < opts.Cycles*2*math.Pi; t += opts.Res {
+			x, y := plot(t, freq, phase)
+			img.SetColorIndex(opts.Size+int(x*size+0.5), opts.Size+int(y*size+0.5), index)
 		}
 		phase += 0.1
-		anim.Delay = append(anim.Delay, delay)
+		anim.Delay = append(anim.Delay, opts.Delay)
 		anim.Image = append(anim.Image, img)
 	}
-	gif.EncodeAll(out, &anim) // NOTE: ignoring encoding errors
+	return gif.EncodeAll(out, &anim)
 }
+
+/*
+Run:
+$ go run gopl.io/ch1/exercise1-12
+
+Open your browser:
+http://localhost:8000/lissajous?cycles=20
+http://localhost:8000/lissajous?size=200&frames=32&delay=4&res=0.0005&seed=42
+http://localhost:8000/lissajous?color=000000&color=ff0000&color=ffff00&color=00ff00&color=00ffff
+http://localhost:8000/lissajous?curve=harmonograph&cycles=40&seed=7
+http://localhost:8000/lissajous?curve=spirograph&cycles=30&color=ffffff&color=2040c0&color=c02040
+*/
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	for _, test := range []struct {
+		opts options
+		ok   bool
+	}{
+		{defaults, true},
+		{options{Cycles: 5, Res: 0.001, Size: 1, Frames: 1, Curve: "spirograph"}, true},
+		{options{Cycles: 5, Res: 0.001, Size: 1000, Frames: 24, Curve: "lissajous"}, true},
+		{options{Cycles: 5, Res: 0.001, Size: 220, Frames: 500, Curve: "lissajous"}, true},
+		{options{Cycles: 0, Res: 0.001, Size: 100, Frames: 64, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0, Size: 100, Frames: 64, Curve: "lissajous"}, false},
+		{options{Cycles: 1e6, Res: 0.001, Size: 100, Frames: 64, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 0, Frames: 64, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 1001, Frames: 1, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 0, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 501, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 1000, Frames: 500, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 64, Delay: -1, Curve: "lissajous"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 64, Curve: "rose"}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 64, Curve: "lissajous",
+			Colors: []string{"ffffff"}}, false},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 64, Curve: "lissajous",
+			Colors: []string{"#000000", "ff8000"}}, true},
+		{options{Cycles: 5, Res: 0.001, Size: 100, Frames: 64, Curve: "lissajous",
+			Colors: []string{"000000", "fff"}}, false},
+	} {
+		_, err := test.opts.check()
+		if (err == nil) != test.ok {
+			t.Errorf("check(%+v) = %v, want ok %t", test.opts, err, test.ok)
+		}
+	}
+}
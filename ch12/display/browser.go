@@ -0,0 +1,368 @@
+package display
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Browser is an http.Handler that shows registered values as HTML
+// trees, in the manner of Display, for inspecting the state of a
+// running program:
+//
+//	var browser display.Browser
+//	browser.Register("cache", cache)
+//	http.Handle("/debug/display", &browser)
+//
+// A request with no query lists the registered values. A request such
+// as ?path=(*cache).Items[3] shows the value at that path, written as
+// Display writes paths, and the fields, elements or entries within it.
+// Each of those that is not a basic value can be expanded in place,
+// and is read from the server only when it is, so a large or cyclic
+// value is explored a level at a time.
+//
+// The Browser reads the values as it serves requests, without any
+// synchronization, so the values shown may be changing as they are
+// read. A zero Browser is ready to use.
+type Browser struct {
+	// Options limit the values shown. MaxElems is the number of
+	// elements of a list shown at each level; MaxDepth is unused.
+	Options Options
+
+	mu    sync.Mutex // guards roots
+	roots map[string]reflect.Value
+}
+
+// Register makes x browsable by name. Register x as a pointer to see
+// its current value on each request. Register panics if name is
+// already registered.
+func (b *Browser) Register(name string, x interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.roots[name]; ok {
+		panic("display: Register called twice for " + name)
+	}
+	if b.roots == nil {
+		b.roots = make(map[string]reflect.Value)
+	}
+	b.roots[name] = reflect.ValueOf(x)
+}
+
+// An item is one line of the tree: a value, its path and its label
+// within the enclosing value, and its type.
+type item struct {
+	Label  string // such as .Title, [3] or the name of a root
+	Path   string // from a root, if the item can be expanded
+	Type   string
+	Value  string // formatted atom, if the item cannot be expanded
+	Expand bool
+}
+
+// ServeHTTP serves the page of the value at the path in the query, or
+// the list of registered values. With the query parameter items=1, it
+// serves just the items of the value, as the page does to expand it.
+func (b *Browser) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := req.FormValue("path")
+	var page struct {
+		Path  string
+		Type  string
+		Items []item
+	}
+	page.Path = path
+	if path == "" {
+		b.mu.Lock()
+		for name, v := range b.roots {
+			page.Items = append(page.Items, b.item(name, name, v))
+		}
+		b.mu.Unlock()
+		sort.Slice(page.Items, func(i, j int) bool {
+			return page.Items[i].Label < page.Items[j].Label
+		})
+	} else {
+		v, err := b.lookup(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		page.Type = typeOf(v)
+		page.Items = b.items(path, v)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	var err error
+	if req.FormValue("items") != "" {
+		err = browserPage.ExecuteTemplate(w, "items", page.Items)
+	} else {
+		err = browserPage.Execute(w, page)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// items returns the items within v, found at path, in the order in
+// which Display would print them.
+func (b *Browser) items(path string, v reflect.Value) []item {
+	var items []item
+	more := func(n int) {
+		if n > 0 {
+			items = append(items, item{Label: "[...]", Value: fmt.Sprintf("%d more", n)})
+		}
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		n := limit(b.Options, v.Len())
+		for i := 0; i < n; i++ {
+			label := fmt.Sprintf("[%d]", i)
+			items = append(items, b.item(label, path+label, v.Index(i)))
+		}
+		more(v.Len() - n)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" && !b.Options.ShowUnexported {
+				continue
+			}
+			label := "." + field.Name
+			items = append(items, b.item(label, path+label, v.Field(i)))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		byIndex := !namedByKey(v.Type().Key())
+		if byIndex || b.Options.SortMapKeys {
+			sortKeys(keys)
+		}
+		n := limit(b.Options, len(keys))
+		for i, key := range keys[:n] {
+			label := "[" + formatAtom(key) + "]"
+			if byIndex {
+				label = fmt.Sprintf("[#%d]", i)
+			}
+			items = append(items, b.item(label, path+label, v.MapIndex(key)))
+		}
+		more(len(keys) - n)
+	case reflect.Ptr:
+		if !v.IsNil() {
+			items = append(items, b.item("*", "(*"+path+")", v.Elem()))
+		}
+	case reflect.Interface:
+		if !v.IsNil() {
+			items = append(items, b.item(".value", path+".value", v.Elem()))
+		}
+	}
+	return items
+}
+
+// item returns the item for v, found at path.
+func (b *Browser) item(label, path string, v reflect.Value) item {
+	it := item{Label: label, Type: typeOf(v)}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			it.Value = "nil"
+			break
+		}
+		it.Path, it.Expand = path, true
+	case reflect.Struct, reflect.Array:
+		it.Path, it.Expand = path, true
+	default: // basic types, channels, funcs
+		it.Value = formatAtom(v)
+	}
+	return it
+}
+
+// namedByKey reports whether the entries of a map with keys of type t
+// are named in paths by their formatted keys, which are distinct for
+// distinct keys of these kinds only and never contain a ']' that
+// scanKey would take for the end of the key, as the type in a
+// formatted pointer such as *[2]int 0xc000010000 may. Other entries,
+// such as those of float, struct, interface or pointer keys, are named
+// [#i] by their index i in the order of sortKeys.
+func namedByKey(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr, reflect.String, reflect.Bool:
+		return true
+	}
+	return false
+}
+
+// typeOf returns the type of v, or of the value within the interface v.
+func typeOf(v reflect.Value) string {
+	if !v.IsValid() {
+		return "invalid"
+	}
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		return v.Type().String() + " (" + v.Elem().Type().String() + ")"
+	}
+	return v.Type().String()
+}
+
+// lookup returns the value at path, such as (*(*x).Items[3]).Name,
+// which begins with the name of a root. A path may select a field
+// .Name, an element [3], a map entry [key] whose key is formatted as
+// Display formats it or [#i] (see namedByKey), the value .value of an
+// interface, and the variable (*path) of a pointer.
+func (b *Browser) lookup(path string) (reflect.Value, error) {
+	bad := func(format string, args ...interface{}) (reflect.Value, error) {
+		return reflect.Value{}, fmt.Errorf("display: bad path %q: %s", path, fmt.Sprintf(format, args...))
+	}
+	rest := path
+	derefs := 0
+	for strings.HasPrefix(rest, "(*") {
+		rest = rest[2:]
+		derefs++
+	}
+
+	// The root is the longest registered name that begins rest.
+	var v reflect.Value
+	name := ""
+	b.mu.Lock()
+	for n, root := range b.roots {
+		if strings.HasPrefix(rest, n) && len(n) > len(name) {
+			name, v = n, root
+		}
+	}
+	b.mu.Unlock()
+	if name == "" {
+		return bad("no such value")
+	}
+	rest = rest[len(name):]
+
+	for rest != "" {
+		switch rest[0] {
+		case ')':
+			if derefs == 0 {
+				return bad("unbalanced )")
+			}
+			if v.Kind() != reflect.Ptr || v.IsNil() {
+				return bad("cannot indirect %s", typeOf(v))
+			}
+			v, rest, derefs = v.Elem(), rest[1:], derefs-1
+		case '.':
+			i := strings.IndexAny(rest[1:], ".[)")
+			if i < 0 {
+				i = len(rest) - 1
+			}
+			sel := rest[1 : 1+i]
+			rest = rest[1+i:]
+			if v.Kind() == reflect.Interface && sel == "value" && !v.IsNil() {
+				v = v.Elem()
+				break
+			}
+			if v.Kind() != reflect.Struct {
+				return bad("%s has no field %s", typeOf(v), sel)
+			}
+			field, ok := v.Type().FieldByName(sel)
+			if !ok || len(field.Index) > 1 || field.PkgPath != "" && !b.Options.ShowUnexported {
+				return bad("%s has no field %s", typeOf(v), sel)
+			}
+			v = v.FieldByIndex(field.Index)
+		case '[':
+			key, n, err := scanKey(rest)
+			if err != nil {
+				return bad("%v", err)
+			}
+			rest = rest[n:]
+			switch v.Kind() {
+			case reflect.Slice, reflect.Array:
+				i, err := strconv.Atoi(key)
+				if err != nil || i < 0 || i >= v.Len() {
+					return bad("index %s out of range", key)
+				}
+				v = v.Index(i)
+			case reflect.Map:
+				if !namedByKey(v.Type().Key()) {
+					keys := v.MapKeys()
+					i, err := strconv.Atoi(strings.TrimPrefix(key, "#"))
+					if !strings.HasPrefix(key, "#") || err != nil || i < 0 || i >= len(keys) {
+						return bad("no map entry %s", key)
+					}
+					sortKeys(keys)
+					v = v.MapIndex(keys[i])
+					break
+				}
+				found := false
+				for _, k := range v.MapKeys() {
+					if formatAtom(k) == key {
+						v, found = v.MapIndex(k), true
+						break
+					}
+				}
+				if !found {
+					return bad("no map entry %s", key)
+				}
+			default:
+				return bad("cannot index %s", typeOf(v))
+			}
+		default:
+			return bad("unexpected %q", rest[0])
+		}
+	}
+	if derefs > 0 {
+		return bad("unbalanced (")
+	}
+	return v, nil
+}
+
+// scanKey returns the text within the brackets that begin s, which may
+// be a quoted string that contains ], and the length of the bracketed
+// text.
+func scanKey(s string) (key string, n int, err error) {
+	i := 1
+	if strings.HasPrefix(s[i:], `"`) {
+		for i++; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' {
+				i++ // skip the escaped character
+			}
+		}
+		if i++; i > len(s) {
+			i = len(s)
+		}
+	}
+	j := strings.IndexByte(s[i:], ']')
+	if j < 0 {
+		return "", 0, fmt.Errorf("missing ]")
+	}
+	return s[1 : i+j], i + j + 1, nil
+}
+
+var browserPage = template.Must(template.New("browser").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>display{{if .Path}} {{.Path}}{{end}}</title>
+<style>
+body    { font-family: monospace; margin: 1em 2em; }
+ul      { list-style: none; padding-left: 1.5em; margin: 0; }
+summary { cursor: pointer; }
+.type   { color: gray; }
+</style>
+</head>
+<body>
+{{if .Path}}<h1><a href="?">display</a> {{.Path}} <span class="type">{{.Type}}</span></h1>
+{{else}}<h1>display</h1>
+{{end}}<ul>
+{{template "items" .Items}}</ul>
+<script>
+// Fetch the items of a value when it is first expanded.
+document.addEventListener("toggle", function(e) {
+	var d = e.target;
+	if (!d.open || d.dataset.loaded) {
+		return;
+	}
+	d.dataset.loaded = true;
+	fetch("?items=1&path=" + encodeURIComponent(d.dataset.path))
+		.then(function(resp) { return resp.text(); })
+		.then(function(html) { d.querySelector("ul").innerHTML = html; });
+}, true);
+</script>
+</body>
+</html>
+{{define "items"}}{{range .}}<li>{{if .Expand}}<details data-path="{{.Path}}"><summary><a href="?path={{.Path}}">{{.Label}}</a> <span class="type">{{.Type}}</span></summary><ul></ul></details>{{else}}{{.Label}} = {{.Value}} <span class="type">{{.Type}}</span>{{end}}</li>
+{{end}}{{end}}`))
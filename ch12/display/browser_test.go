@@ -0,0 +1,164 @@
+package display
+
+import (
+	"io"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type server struct {
+	Name   string
+	Items  []*entry
+	Hits   map[string]int
+	Spans  map[[2]float64]string
+	Owners map[*[2]int]string // formatted keys contain ]
+	Last   interface{}
+	self   *server
+	secret string
+}
+
+type entry struct {
+	Key  string
+	Next *entry
+}
+
+func newBrowser() (*Browser, *server) {
+	s := &server{
+		Name:   "cache",
+		Items:  []*entry{{Key: "a"}, {Key: "b]c"}},
+		Hits:   map[string]int{"a": 1, "x.y[z]": 2},
+		Spans:  map[[2]float64]string{{0.5, 1}: "a", {0.25, 2}: "b"},
+		Owners: map[*[2]int]string{{1, 2}: "ann"},
+		secret: "s",
+	}
+	s.Items[0].Next = s.Items[1]
+	s.Items[1].Next = s.Items[0]
+	s.Last = s.Items[1]
+	s.self = s
+	b := &Browser{Options: Options{SortMapKeys: true}}
+	b.Register("srv", s)
+	b.Register("srv.limits", [2]int{10, 20})
+	return b, s
+}
+
+func TestBrowserLookup(t *testing.T) {
+	b, _ := newBrowser()
+	for _, test := range []struct {
+		path, want string
+	}{
+		{"srv", "*display.server 0x"},
+		{"(*srv).Name", `"cache"`},
+		{"(*(*srv).Items[1]).Key", `"b]c"`},
+		{"(*(*(*srv).Items[0]).Next).Key", `"b]c"`},
+		{`(*srv).Hits["x.y[z]"]`, "2"},
+		{"(*srv).Spans[#0]", `"b"`},
+		{"(*srv).Spans[#1]", `"a"`},
+		{"(*srv).Owners[#0]", `"ann"`},
+		{"(*(*srv).Last.value).Key", `"b]c"`},
+		{"srv.limits[1]", "20"},
+	} {
+		v, err := b.lookup(test.path)
+		if err != nil {
+			t.Errorf("lookup(%s): %v", test.path, err)
+			continue
+		}
+		if got := formatAtom(v); !strings.HasPrefix(got, test.want) {
+			t.Errorf("lookup(%s) = %s, want %s", test.path, got, test.want)
+		}
+	}
+
+	for _, path := range []string{
+		"nosuch",
+		"srv.Name",
+		"(*srv).secret",
+		"(*srv).Items[2]",
+		"(*srv).Items[-1]",
+		`(*srv).Hits["b"]`,
+		"(*srv).Spans[#2]",
+		"(*srv).Spans[1]",
+		"(*srv).Spans[[2]float64 value]",
+		"(*srv).Owners[#1]",
+		"(*srv).Items[0",
+		"(*(*srv).Name)",
+		"(*srv",
+		"srv)",
+		"(*srv)x",
+	} {
+		if _, err := b.lookup(path); err == nil {
+			t.Errorf("lookup(%s) succeeded, want error", path)
+		}
+	}
+
+	b.Options.ShowUnexported = true
+	if v, err := b.lookup("(*(*srv).self).secret"); err != nil || v.String() != "s" {
+		t.Errorf("lookup of unexported field = %v, %v", v, err)
+	}
+}
+
+func TestBrowser(t *testing.T) {
+	b, _ := newBrowser()
+	get := func(query string) (int, string) {
+		rec := httptest.NewRecorder()
+		b.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/display?"+query, nil))
+		body, _ := io.ReadAll(rec.Body)
+		return rec.Code, string(body)
+	}
+
+	for _, test := range []struct {
+		query string
+		want  []string // substrings of the body
+	}{
+		{"", []string{
+			"<h1>display</h1>",
+			`<a href="?path=srv">srv</a>`,
+			`<a href="?path=srv.limits">srv.limits</a>`,
+		}},
+		{"path=" + url.QueryEscape("(*srv)"), []string{
+			`<span class="type">display.server</span>`,
+			`.Name = &#34;cache&#34;`,
+			`<details data-path="(*srv).Items">`,
+			`<a href="?path=%28%2asrv%29.Hits">.Hits</a>`,
+			`<span class="type">interface {} (*display.entry)</span>`,
+		}},
+		{"path=" + url.QueryEscape("(*srv).Hits"), []string{
+			`[&#34;a&#34;] = 1`,
+			`[&#34;x.y[z]&#34;] = 2`,
+		}},
+		{"path=" + url.QueryEscape("(*srv).Spans"), []string{
+			`[#0] = &#34;b&#34;`,
+			`[#1] = &#34;a&#34;`,
+		}},
+		{"path=" + url.QueryEscape("(*srv).Owners"), []string{
+			`[#0] = &#34;ann&#34;`,
+		}},
+	} {
+		code, body := get(test.query)
+		if code != 200 {
+			t.Errorf("GET ?%s: status %d: %s", test.query, code, body)
+			continue
+		}
+		for _, want := range test.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET ?%s: body lacks %s:\n%s", test.query, want, body)
+			}
+		}
+		if strings.Contains(body, "secret") {
+			t.Errorf("GET ?%s: body shows unexported field:\n%s", test.query, body)
+		}
+	}
+
+	// Expanding a node fetches just its items.
+	b.Options.MaxElems = 1
+	code, body := get("items=1&path=" + url.QueryEscape("(*srv).Items"))
+	if code != 200 || strings.Contains(body, "<html>") ||
+		!strings.HasPrefix(body, `<li><details data-path="(*srv).Items[0]">`) ||
+		!strings.Contains(body, "[...] = 1 more") {
+		t.Errorf("GET items of (*srv).Items: status %d:\n%s", code, body)
+	}
+
+	if code, _ := get("path=nosuch"); code != 404 {
+		t.Errorf("GET nosuch: status %d, want 404", code)
+	}
+}
@@ -3,8 +3,12 @@ package display
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 // Display is a recursive value printer.
@@ -12,10 +16,72 @@ import (
 // value `x`, prints the complete structure of that value, labeling each element
 // with the path by which it was found.
 func Display(name string, x interface{}) {
-	fmt.Printf("Display %s (%T):\n", name, x)
+	Fprint(os.Stdout, name, x, Options{ShowUnexported: true})
+}
+
+// Options control the output of Fprint. The zero Options display all
+// of a value except its unexported fields, with map entries in no
+// particular order.
+type Options struct {
+	// MaxDepth, if positive, is the number of fields, elements and map
+	// entries that may be selected along a path. Deeper structs,
+	// arrays, slices and maps are shown as their type followed by
+	// "...". Following a pointer or an interface does not count.
+	MaxDepth int
+
+	// MaxElems, if positive, is the number of elements of each array,
+	// slice or map to display. The rest are counted, as in
+	//
+	//	x.Items[...] = 97 more
+	MaxElems int
+
+	// ShowUnexported causes unexported struct fields to be displayed.
+	ShowUnexported bool
+
+	// SortMapKeys causes map entries to be displayed in order of their
+	// keys, so that the output is deterministic.
+	SortMapKeys bool
+}
+
+// Fprint is like Display, but writes to w, as limited by opts. It
+// returns the first error from w.
+//
+// Fprint is safe to use on values with cycles, such as the state of a
+// running server. A pointer, map or slice that has been displayed once
+// is displayed again as just the path at which it was first found:
+//
+//	c.Value = 42
+//	(*c.Tail).Value = 42
+//	(*c.Tail).Tail = c.Tail
+func Fprint(w io.Writer, name string, x interface{}, opts Options) error {
+	p := &printer{w: w, opts: opts, seen: make(map[ref]string)}
+	p.printf("Display %s (%T):\n", name, x)
 	// Where possible, you should avoid exposing reflection in the API of a
 	// package.
-	display(name, reflect.ValueOf(x))
+	p.display(name, reflect.ValueOf(x), 0)
+	return p.err
+}
+
+// A ref identifies the variable that a pointer points to, or the
+// elements of a map or slice, so that it is displayed only once.
+type ref struct {
+	p uintptr
+	t reflect.Type
+	n int // length of a slice
+}
+
+// A printer holds the state of a call to Fprint.
+type printer struct {
+	w    io.Writer
+	opts Options
+	seen map[ref]string // path of each pointer, map and slice displayed
+	err  error          // first error from w
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
 }
 
 // formatAtom formats a value without inspecting its internal structure.
@@ -43,43 +109,197 @@ func formatAtom(v reflect.Value) string {
 	}
 }
 
-// display do the real work of the recursion.
-func display(path string, v reflect.Value) {
+// display do the real work of the recursion. The value v is found at
+// depth selections from the root.
+func (p *printer) display(path string, v reflect.Value, depth int) {
 	// Use the `formatAtom` function we defined earlier to print elementary
 	// values--basic types, functions, and channels—but we’ll use the methods of
 	// `reflect.Value` to recursively display each component of a more complex
 	// type.
+	if p.err != nil {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Struct, reflect.Map:
+		if p.opts.MaxDepth > 0 && depth >= p.opts.MaxDepth {
+			p.printf("%s = %s ...\n", path, v.Type())
+			return
+		}
+		if p.visited(path, v) {
+			return
+		}
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
-		fmt.Printf("%s = invalid\n", path)
+		p.printf("%s = invalid\n", path)
 	case reflect.Slice, reflect.Array:
-		for i := 0; i < v.Len(); i++ {
-			display(fmt.Sprintf("%s[%d]", path, i), v.Index(i))
+		n := limit(p.opts, v.Len())
+		for i := 0; i < n; i++ {
+			p.display(fmt.Sprintf("%s[%d]", path, i), v.Index(i), depth+1)
 		}
+		p.more(path, v.Len()-n)
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
-			fieldPath := fmt.Sprintf("%s.%s", path, v.Type().Field(i).Name)
-			display(fieldPath, v.Field(i))
+			field := v.Type().Field(i)
+			if field.PkgPath != "" && !p.opts.ShowUnexported {
+				continue
+			}
+			fieldPath := fmt.Sprintf("%s.%s", path, field.Name)
+			p.display(fieldPath, v.Field(i), depth+1)
 		}
 	case reflect.Map:
-		for _, key := range v.MapKeys() {
-			display(fmt.Sprintf("%s[%s]", path, formatAtom(key)),
-				v.MapIndex(key))
+		keys := v.MapKeys()
+		if p.opts.SortMapKeys {
+			sortKeys(keys)
 		}
+		n := limit(p.opts, len(keys))
+		for _, key := range keys[:n] {
+			p.display(fmt.Sprintf("%s[%s]", path, formatAtom(key)),
+				v.MapIndex(key), depth+1)
+		}
+		p.more(path, len(keys)-n)
 	case reflect.Ptr:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
-		} else {
-			display(fmt.Sprintf("(*%s)", path), v.Elem())
+			p.printf("%s = nil\n", path)
+		} else if !p.visited(path, v) {
+			p.display(fmt.Sprintf("(*%s)", path), v.Elem(), depth)
 		}
 	case reflect.Interface:
 		if v.IsNil() {
-			fmt.Printf("%s = nil\n", path)
+			p.printf("%s = nil\n", path)
 		} else {
-			fmt.Printf("%s.type = %s\n", path, v.Elem().Type())
-			display(path+".value", v.Elem())
+			p.printf("%s.type = %s\n", path, v.Elem().Type())
+			p.display(path+".value", v.Elem(), depth)
 		}
 	default: // basic types, channels, funcs
-		fmt.Printf("%s = %s\n", path, formatAtom(v))
+		p.printf("%s = %s\n", path, formatAtom(v))
+	}
+}
+
+// visited reports whether the pointer, map or slice v, found at path,
+// has already been displayed, and if so, prints the path at which it
+// was first found. Other values, and those with nothing to display
+// such as an empty slice or a pointer to a zero-sized variable, are
+// never visited.
+func (p *printer) visited(path string, v reflect.Value) bool {
+	var r ref
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.Type().Elem().Size() == 0 {
+			return false
+		}
+		r = ref{v.Pointer(), v.Type(), 0}
+	case reflect.Map:
+		if v.Len() == 0 {
+			return false
+		}
+		r = ref{v.Pointer(), v.Type(), 0}
+	case reflect.Slice:
+		if v.Len() == 0 || v.Type().Elem().Size() == 0 {
+			return false
+		}
+		r = ref{v.Pointer(), v.Type(), v.Len()}
+	default:
+		return false
+	}
+	if first, ok := p.seen[r]; ok {
+		p.printf("%s = %s\n", path, first)
+		return true
+	}
+	p.seen[r] = path
+	return false
+}
+
+// limit returns the number of the n elements of a list to display.
+func limit(opts Options, n int) int {
+	if opts.MaxElems > 0 && n > opts.MaxElems {
+		return opts.MaxElems
+	}
+	return n
+}
+
+// more prints the number of elements of the list at path that are
+// not displayed, if any.
+func (p *printer) more(path string, n int) {
+	if n > 0 {
+		p.printf("%s[...] = %d more\n", path, n)
+	}
+}
+
+// sortKeys sorts map keys by value, so that the entries of a map are
+// displayed in the same order every time.
+func sortKeys(keys []reflect.Value) {
+	sort.SliceStable(keys, func(i, j int) bool {
+		return compare(keys[i], keys[j]) < 0
+	})
+}
+
+// compare returns -1, 0 or +1 as x is less than, equal to, or greater
+// than y, two values of the same type. Numbers, strings and booleans
+// are ordered by value; structs and arrays field by field or element
+// by element; pointers and channels by address. The values within
+// interfaces are ordered by kind, then by type, then by value, with
+// nil first.
+func compare(x, y reflect.Value) int {
+	switch x.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		return order(x.Int() < y.Int(), x.Int() > y.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return order(x.Uint() < y.Uint(), x.Uint() > y.Uint())
+	case reflect.Float32, reflect.Float64:
+		return order(x.Float() < y.Float(), x.Float() > y.Float())
+	case reflect.Complex64, reflect.Complex128:
+		a, b := x.Complex(), y.Complex()
+		if c := order(real(a) < real(b), real(a) > real(b)); c != 0 {
+			return c
+		}
+		return order(imag(a) < imag(b), imag(a) > imag(b))
+	case reflect.String:
+		return strings.Compare(x.String(), y.String())
+	case reflect.Bool:
+		return order(!x.Bool() && y.Bool(), x.Bool() && !y.Bool())
+	case reflect.Ptr, reflect.Chan, reflect.UnsafePointer:
+		return order(x.Pointer() < y.Pointer(), x.Pointer() > y.Pointer())
+	case reflect.Struct:
+		for i := 0; i < x.NumField(); i++ {
+			if c := compare(x.Field(i), y.Field(i)); c != 0 {
+				return c
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < x.Len(); i++ {
+			if c := compare(x.Index(i), y.Index(i)); c != 0 {
+				return c
+			}
+		}
+	case reflect.Interface:
+		if x.IsNil() || y.IsNil() {
+			return order(x.IsNil() && !y.IsNil(), !x.IsNil() && y.IsNil())
+		}
+		x, y := x.Elem(), y.Elem()
+		if c := order(x.Kind() < y.Kind(), x.Kind() > y.Kind()); c != 0 {
+			return c
+		}
+		if c := strings.Compare(x.Type().String(), y.Type().String()); c != 0 {
+			return c
+		}
+		if x.Type() != y.Type() {
+			return 0 // distinct types with the same name
+		}
+		return compare(x, y)
+	}
+	return 0
+}
+
+// order returns -1 if less, +1 if greater, and 0 otherwise.
+func order(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return +1
 	}
+	return 0
 }
@@ -1,10 +1,13 @@
 package display
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
@@ -197,34 +200,28 @@ func Test(t *testing.T) {
 	type P *P
 	var p P
 	p = &p
-	if false {
-		Display("p", p)
-		// Output:
-		// Display p (display.P):
-		// ...stuck, no output...
-	}
+	Display("p", p)
+	// Output:
+	// Display p (display.P):
+	// (*p) = p
 
 	// a map that contains itself
 	type M map[string]M
 	m := make(M)
 	m[""] = m
-	if false {
-		Display("m", m)
-		// Output:
-		// Display m (display.M):
-		// ...stuck, no output...
-	}
+	Display("m", m)
+	// Output:
+	// Display m (display.M):
+	// m[""] = m
 
 	// a slice that contains itself
 	type S []S
 	s := make(S, 1)
 	s[0] = s
-	if false {
-		Display("s", s)
-		// Output:
-		// Display s (display.S):
-		// ...stuck, no output...
-	}
+	Display("s", s)
+	// Output:
+	// Display s (display.S):
+	// s[0] = s
 
 	// a linked list that eats its own tail
 	type Cycle struct {
@@ -233,13 +230,196 @@ func Test(t *testing.T) {
 	}
 	var c Cycle
 	c = Cycle{42, &c}
-	if false {
-		Display("c", c)
-		// Output:
-		// Display c (display.Cycle):
-		// c.Value = 42
-		// (*c.Tail).Value = 42
-		// (*(*c.Tail).Tail).Value = 42
-		// ...ad infinitum...
+	Display("c", c)
+	// Output:
+	// Display c (display.Cycle):
+	// c.Value = 42
+	// (*c.Tail).Value = 42
+	// (*c.Tail).Tail = c.Tail
+}
+
+func ExampleFprint() {
+	type Node struct {
+		Name     string
+		Children []*Node
+		parent   *Node
+	}
+	root := &Node{Name: "root"}
+	for _, name := range []string{"a", "b", "c"} {
+		root.Children = append(root.Children, &Node{name, nil, root})
+	}
+	root.Children[0].Children = []*Node{root.Children[2]}
+	Fprint(os.Stdout, "root", root, Options{MaxElems: 2, ShowUnexported: true})
+	// Output:
+	// Display root (*display.Node):
+	// (*root).Name = "root"
+	// (*(*root).Children[0]).Name = "a"
+	// (*(*(*root).Children[0]).Children[0]).Name = "c"
+	// (*(*(*root).Children[0]).Children[0]).parent = root
+	// (*(*root).Children[0]).parent = root
+	// (*(*root).Children[1]).Name = "b"
+	// (*(*root).Children[1]).parent = root
+	// (*root).Children[...] = 1 more
+	// (*root).parent = nil
+}
+
+func TestFprint(t *testing.T) {
+	type Tree struct {
+		Label string
+		Kids  map[int]*Tree
+		depth int
+	}
+	tree := &Tree{"a", map[int]*Tree{
+		3: {"d", nil, 1},
+		1: {"b", map[int]*Tree{0: {"c", nil, 2}}, 1},
+		2: {"c", nil, 1},
+	}, 0}
+	for _, test := range []struct {
+		opts Options
+		want string
+	}{
+		{Options{SortMapKeys: true}, `Display t (*display.Tree):
+(*t).Label = "a"
+(*(*t).Kids[1]).Label = "b"
+(*(*(*t).Kids[1]).Kids[0]).Label = "c"
+(*(*t).Kids[2]).Label = "c"
+(*(*t).Kids[3]).Label = "d"
+`},
+		{Options{MaxDepth: 2, MaxElems: 1, ShowUnexported: true, SortMapKeys: true}, `Display t (*display.Tree):
+(*t).Label = "a"
+(*(*t).Kids[1]) = display.Tree ...
+(*t).Kids[...] = 2 more
+(*t).depth = 0
+`},
+	} {
+		var buf strings.Builder
+		if err := Fprint(&buf, "t", tree, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("Fprint(%+v) =\n%s\nwant\n%s", test.opts, got, test.want)
+		}
+	}
+
+	if err := Fprint(errWriter{}, "t", tree, Options{}); err != errWrite {
+		t.Errorf("Fprint(errWriter) = %v, want %v", err, errWrite)
+	}
+}
+
+var errWrite = errors.New("write failed")
+
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errWrite }
+
+func ExampleFprintDot() {
+	e, _ := eval.Parse("sqrt(A / pi)")
+	FprintDot(os.Stdout, "e", e, Options{ShowUnexported: true})
+	// Output:
+	// digraph "e" {
+	// 	node [shape=record];
+	// 	root [style=rounded, label="e"];
+	// 	root -> n0 [style=dashed];
+	// 	n0 [label="{eval.call|<f1> fn = \"sqrt\"|<f2> args}"];
+	// 	n0:f2 -> n1;
+	// 	n1 [label="{[]eval.Expr|<f1> [0]}"];
+	// 	n1:f1 -> n2 [style=dashed];
+	// 	n2 [label="{eval.binary|<f1> op = 47|<f2> x = \"A\"|<f3> y = \"pi\"}"];
+	// }
+}
+
+func TestFprintDot(t *testing.T) {
+	type List struct {
+		Value int
+		Next  *List
+	}
+	c := &List{1, nil}
+	c.Next = &List{2, c}
+	s := `{"|"}`
+	for _, test := range []struct {
+		x    interface{}
+		opts Options
+		want string
+	}{
+		{c, Options{}, `digraph "x" {
+	node [shape=record];
+	root [style=rounded, label="x"];
+	root -> n0;
+	n0 [label="{display.List|<f1> Value = 1|<f2> Next}"];
+	n0:f2 -> n1;
+	n1 [label="{display.List|<f1> Value = 2|<f2> Next}"];
+	n1:f2 -> n0;
+}
+`},
+		{[]*string{&s, &s, nil}, Options{}, `digraph "x" {
+	node [shape=record];
+	root [style=rounded, label="x"];
+	root -> n0;
+	n0 [label="{[]*string|<f1> [0]|<f2> [1]|<f3> [2] = nil}"];
+	n0:f1 -> n1;
+	n0:f2 -> n1;
+	n1 [label="{string|<f1> \"\{\\\"\|\\\"\}\"}"];
+}
+`},
+		{map[string][]int{"b": nil, "a": {1, 2, 3}}, Options{MaxDepth: 1, SortMapKeys: true}, `digraph "x" {
+	node [shape=record];
+	root [style=rounded, label="x"];
+	root -> n0;
+	n0 [label="{map[string][]int|<f1> [\"a\"] = []int ...|<f2> [\"b\"] = nil}"];
+}
+`},
+		{[][]int{{1, 2, 3}}, Options{MaxElems: 2}, `digraph "x" {
+	node [shape=record];
+	root [style=rounded, label="x"];
+	root -> n0;
+	n0 [label="{[][]int|<f1> [0]}"];
+	n0:f1 -> n1;
+	n1 [label="{[]int|<f1> [0] = 1|<f2> [1] = 2|[...] = 1 more}"];
+}
+`},
+		{3, Options{}, `digraph "x" {
+	node [shape=record];
+	root [style=rounded, label="x = 3"];
+}
+`},
+	} {
+		var buf strings.Builder
+		if err := FprintDot(&buf, "x", test.x, test.opts); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("FprintDot(%v, %+v) =\n%s\nwant\n%s", test.x, test.opts, got, test.want)
+		}
+	}
+}
+
+func TestSortMapKeys(t *testing.T) {
+	type K struct {
+		A int
+		B string
+	}
+	m := map[interface{}]int{
+		nil: 0, 2: 1, 1: 2, "b": 3, "a": 4, 2.5: 5, 1.5: 6,
+		K{1, "y"}: 7, K{1, "x"}: 8, K{0, "z"}: 9,
+		[2]int{1, 2}: 10, [2]int{1, 1}: 11, true: 12, false: 13,
+	}
+	var first string
+	for i := 0; i < 20; i++ {
+		var buf strings.Builder
+		Fprint(&buf, "m", m, Options{SortMapKeys: true})
+		if i == 0 {
+			first = buf.String()
+		} else if buf.String() != first {
+			t.Fatalf("Fprint with SortMapKeys is not deterministic:\n%s\nthen\n%s", first, buf.String())
+		}
+	}
+	// formatAtom shows only the type of an interface key, so check
+	// the order by the values.
+	want := "Display m (map[interface {}]int):\n"
+	for _, v := range []int{0, 13, 12, 2, 1, 6, 5, 11, 10, 4, 3, 9, 8, 7} {
+		want += fmt.Sprintf("m[interface {} value] = %d\n", v)
+	}
+	if first != want {
+		t.Errorf("Fprint(m) =\n%s\nwant\n%s", first, want)
 	}
 }
@@ -0,0 +1,232 @@
+package display
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// FprintDot writes to w a Graphviz DOT graph of x, limited by opts as
+// Fprint is. It returns the first error from w.
+//
+// Each struct, array, slice and map is a node that lists its fields,
+// elements or entries; the basic values among them are shown in place,
+// and the others lead by an edge to nodes of their own. Solid edges
+// are pointers, including maps and slices, and dashed edges lead to
+// structs and arrays held by value. A variable reached by several
+// pointers, as on a cycle, is drawn once. For example,
+//
+//	$ go run main.go | dot -Tsvg > graph.svg
+//
+// draws the graph written by a program that calls
+//
+//	display.FprintDot(os.Stdout, "tree", tree, display.Options{ShowUnexported: true})
+func FprintDot(w io.Writer, name string, x interface{}, opts Options) error {
+	g := &graph{w: w, opts: opts, nodes: make(map[ref]string)}
+	g.printf("digraph %s {\n", quote(name))
+	g.printf("\tnode [shape=record];\n")
+	label := g.field("root", name, reflect.ValueOf(x), 0)
+	g.printf("\troot [style=rounded, label=\"%s\"];\n", label)
+	g.flush()
+	// Write the nodes breadth first, so that they appear in the
+	// output near the root.
+	for len(g.queue) > 0 {
+		n := g.queue[0]
+		g.queue = g.queue[1:]
+		g.write(n)
+	}
+	g.printf("}\n")
+	return g.err
+}
+
+// A graph holds the state of a call to FprintDot.
+type graph struct {
+	w     io.Writer
+	opts  Options
+	nodes map[ref]string // node of each variable pointed to, map and slice
+	next  int            // number of the next node
+	queue []node         // nodes to be written
+	edges []string       // edges from the node being written
+	err   error          // first error from w
+}
+
+// A node is a value to be drawn as a node of the graph.
+type node struct {
+	id    string
+	v     reflect.Value
+	depth int // number of selections from the root
+}
+
+func (g *graph) printf(format string, args ...interface{}) {
+	if g.err == nil {
+		_, g.err = fmt.Fprintf(g.w, format, args...)
+	}
+}
+
+// field returns the label of the field of a node at port from that
+// holds v, found at depth selections from the root. If v is not a
+// basic value, field adds an edge from port to the node of v.
+func (g *graph) field(from, label string, v reflect.Value, depth int) string {
+	atom := func(s string) string {
+		if label == "" {
+			return escape(s)
+		}
+		return escape(label + " = " + s)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return atom("nil")
+		}
+		r := ref{v.Pointer(), v.Type(), 0}
+		shared := v.Type().Elem().Size() > 0
+		if id, ok := g.nodes[r]; ok && shared {
+			g.edge(from, id, "")
+			return escape(label)
+		}
+		if g.tooDeep(v.Elem(), depth) {
+			return atom(v.Type().String() + " ...")
+		}
+		var key *ref
+		if shared {
+			key = &r
+		}
+		g.edge(from, g.node(v.Elem(), depth, key), "")
+		return escape(label)
+	case reflect.Interface:
+		if v.IsNil() {
+			return atom("nil")
+		}
+		return g.field(from, label, v.Elem(), depth)
+	case reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return atom("nil")
+		}
+		r := ref{v.Pointer(), v.Type(), 0}
+		if v.Kind() == reflect.Slice {
+			r.n = v.Len()
+		}
+		shared := v.Len() > 0 && v.Type().Elem().Size() > 0
+		if id, ok := g.nodes[r]; ok && shared {
+			g.edge(from, id, "")
+			return escape(label)
+		}
+		if g.tooDeep(v, depth) {
+			return atom(v.Type().String() + " ...")
+		}
+		var key *ref
+		if shared {
+			key = &r
+		}
+		g.edge(from, g.node(v, depth, key), "")
+		return escape(label)
+	case reflect.Struct, reflect.Array:
+		if g.tooDeep(v, depth) {
+			return atom(v.Type().String() + " ...")
+		}
+		g.edge(from, g.node(v, depth, nil), " [style=dashed]")
+		return escape(label)
+	default: // basic types, channels, funcs
+		return atom(formatAtom(v))
+	}
+}
+
+// tooDeep reports whether v, found at depth, is a struct, array, slice
+// or map too deep to draw.
+func (g *graph) tooDeep(v reflect.Value, depth int) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array, reflect.Slice, reflect.Map:
+		return g.opts.MaxDepth > 0 && depth >= g.opts.MaxDepth
+	}
+	return false
+}
+
+// node queues a node for v, found at depth, and returns its name.
+// If key is not nil, the node is recorded as the node of key.
+func (g *graph) node(v reflect.Value, depth int, key *ref) string {
+	id := fmt.Sprintf("n%d", g.next)
+	g.next++
+	if key != nil {
+		g.nodes[*key] = id
+	}
+	g.queue = append(g.queue, node{id, v, depth})
+	return id
+}
+
+// write writes node n and its edges.
+func (g *graph) write(n node) {
+	v := n.v
+	fields := []string{escape(v.Type().String())}
+	add := func(label string, v reflect.Value) {
+		port := fmt.Sprintf("f%d", len(fields))
+		label = g.field(n.id+":"+port, label, v, n.depth+1)
+		fields = append(fields, "<"+port+"> "+label)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" && !g.opts.ShowUnexported {
+				continue
+			}
+			add(field.Name, v.Field(i))
+		}
+	case reflect.Array, reflect.Slice:
+		n := limit(g.opts, v.Len())
+		for i := 0; i < n; i++ {
+			add(fmt.Sprintf("[%d]", i), v.Index(i))
+		}
+		if n < v.Len() {
+			fields = append(fields, escape(fmt.Sprintf("[...] = %d more", v.Len()-n)))
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		if g.opts.SortMapKeys {
+			sortKeys(keys)
+		}
+		n := limit(g.opts, len(keys))
+		for _, key := range keys[:n] {
+			add("["+formatAtom(key)+"]", v.MapIndex(key))
+		}
+		if n < len(keys) {
+			fields = append(fields, escape(fmt.Sprintf("[...] = %d more", len(keys)-n)))
+		}
+	default: // the variable of a pointer to a basic value or a pointer
+		add("", v)
+	}
+	g.printf("\t%s [label=\"{%s}\"];\n", n.id, strings.Join(fields, "|"))
+	g.flush()
+}
+
+// edge adds an edge from port to node, with the given attributes, to
+// be written after the node of the port.
+func (g *graph) edge(from, to, attrs string) {
+	g.edges = append(g.edges, fmt.Sprintf("\t%s -> %s%s;\n", from, to, attrs))
+}
+
+// flush writes the edges added since the last flush.
+func (g *graph) flush() {
+	for _, e := range g.edges {
+		g.printf("%s", e)
+	}
+	g.edges = g.edges[:0]
+}
+
+// escape escapes the characters of s that are special in a record
+// label within a DOT string.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`{}|<>"\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// quote returns s as a DOT string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -75,8 +75,8 @@ func Unpack(req *http.Request, ptr interface{}) error {
 
 // populate takes care of setting a single field `v` (or a single element of a
 // slice field) from a parameter value. For now, it supports only strings,
-// signed integers, and booleans. Supporting other types is left as an
-// improvement.
+// signed integers, floating-point numbers, and booleans. Supporting other
+// types is left as an improvement.
 func populate(v reflect.Value, value string) error {
 	switch v.Kind() {
 	case reflect.String:
@@ -89,6 +89,13 @@ func populate(v reflect.Value, value string) error {
 		}
 		v.SetInt(i)
 
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
 	case reflect.Bool:
 		b, err := strconv.ParseBool(value)
 		if err != nil {
@@ -0,0 +1,50 @@
+package params
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestUnpack(t *testing.T) {
+	type data struct {
+		Labels []string `http:"l"`
+		Max    int      `http:"max"`
+		Scale  float64
+		Ratio  float32
+		Exact  bool `http:"x"`
+	}
+	for _, test := range []struct {
+		query string
+		want  data
+	}{
+		{"", data{}},
+		{"l=a&l=b&max=10&x=true", data{Labels: []string{"a", "b"}, Max: 10, Exact: true}},
+		{"scale=2.5&ratio=0.1", data{Scale: 2.5, Ratio: 0.1}},
+		{"scale=-1e3&scale=4", data{Scale: 4}},
+		{"scale=.5&ratio=3", data{Scale: 0.5, Ratio: 3}},
+	} {
+		var got data
+		req := httptest.NewRequest("GET", "/?"+test.query, nil)
+		if err := Unpack(req, &got); err != nil {
+			t.Errorf("Unpack(%s): %v", test.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Unpack(%s) = %+v, want %+v", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{
+		"max=1.5",
+		"scale=x",
+		"scale=",
+		"ratio=1e39",
+		"x=maybe",
+	} {
+		var got data
+		if err := Unpack(httptest.NewRequest("GET", "/?"+query, nil), &got); err == nil {
+			t.Errorf("Unpack(%s) succeeded, want error", query)
+		}
+	}
+}
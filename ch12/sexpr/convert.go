@@ -0,0 +1,583 @@
+package sexpr
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// This file converts S-expressions to and from JSON and XML, without
+// reference to Go types. The JSON mapping is:
+//
+//	S-expression               JSON
+//	"text"                     "text"
+//	42, 1.5                    42, 1.5
+//	t                          true
+//	nil                        null
+//	false                      false
+//	other symbol foo           {"#symbol": "foo"}
+//	((name value) ...)         {"name": value, ...}
+//	(("key" value) ...)        {"key": value, ...}
+//	(value ...)                [value, ...]
+//	#C(1 2), #1=value          {"#C": [1, 2]}, {"#1=": value}
+//
+// A list is an object if it is not empty and each of its elements is a
+// pair whose first element is a symbol, as in the encoding of a
+// struct, or a string, as in the encoding of a map with string keys.
+// A string key that could be mistaken for a symbol key, such as "Year",
+// is written quoted, as "\"Year\"", and so is one that could be
+// mistaken for such a quoted key; other JSON keys are strings, such as
+// "max results". A single pair whose key is a string such as "#C",
+// which would be mistaken for a macro, is an array instead.
+//
+// The XML mapping names each element for the kind of its value:
+//
+//	"text"                     <string>text</string>
+//	42, 1.5                    <int>42</int>, <float>1.5</float>
+//	t, foo                     <symbol>t</symbol>, <symbol>foo</symbol>
+//	((name value) ...)         <object><name>value</name>...</object>
+//	(value ...)                <list>value...</list>
+//	#C(1 2)                    <macro name="#C"><list>...</list></macro>
+//
+// Converting an S-expression to either form and back yields an
+// equivalent S-expression, differing at most in spacing and in the
+// spelling of numbers.
+
+// isObject reports whether list is a non-empty list of pairs whose
+// first elements are symbols other than t and nil. Only such a list
+// is an XML object, since its keys are element names.
+func isObject(list List) bool {
+	for _, item := range list {
+		pair, ok := item.(List)
+		if !ok || len(pair) != 2 {
+			return false
+		}
+		if name, ok := pair[0].(Symbol); !ok || !isSymbol(string(name)) {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+// isJSONObject reports whether list is a non-empty list of pairs
+// whose first elements are keys of a JSON object; see jsonKey.
+func isJSONObject(list List) bool {
+	for _, item := range list {
+		pair, ok := item.(List)
+		if !ok || len(pair) != 2 {
+			return false
+		}
+		if _, ok := jsonKey(pair[0]); !ok {
+			return false
+		}
+		if s, ok := pair[0].(String); ok && len(list) == 1 && isSpecial(string(s)) {
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+// jsonKey returns the JSON object key for the first element k of a
+// pair, and reports whether k may be one.
+func jsonKey(k Value) (string, bool) {
+	switch k := k.(type) {
+	case Symbol:
+		return string(k), isSymbol(string(k))
+	case String:
+		if isSymbol(string(k)) || isQuotedKey(string(k)) {
+			return strconv.Quote(string(k)), true
+		}
+		return string(k), true
+	}
+	return "", false
+}
+
+// readKey is the inverse of jsonKey.
+func readKey(key string) Value {
+	if isSymbol(key) {
+		return Symbol(key)
+	}
+	if isQuotedKey(key) {
+		s, _ := strconv.Unquote(key)
+		return String(s)
+	}
+	return String(key)
+}
+
+// isQuotedKey reports whether key is a string key quoted by jsonKey.
+func isQuotedKey(key string) bool {
+	s, err := strconv.Unquote(key)
+	return err == nil && key == strconv.Quote(s) && (isSymbol(s) || isQuotedKey(s))
+}
+
+// isSymbol reports whether s may be written as a symbol.
+func isSymbol(s string) bool {
+	for i, r := range s {
+		if !(unicode.IsLetter(r) || r == '_' || i > 0 && unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return s != "" && s != "t" && s != "nil"
+}
+
+// writeTree writes tree to w as an S-expression.
+func writeTree(w *bufio.Writer, tree Value) error {
+	switch tree := tree.(type) {
+	case Symbol:
+		w.WriteString(string(tree))
+	case String:
+		w.WriteString(strconv.Quote(string(tree)))
+	case Int:
+		w.WriteString(strconv.FormatInt(int64(tree), 10))
+	case Float:
+		s, err := formatFloatValue(tree)
+		if err != nil {
+			return err
+		}
+		w.WriteString(s)
+	case Macro:
+		w.WriteString(tree.Name)
+		return writeTree(w, tree.Datum)
+	case Comment:
+		w.WriteString(";" + string(tree) + "\n")
+	case List:
+		w.WriteByte('(')
+		for i, item := range tree {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			if err := writeTree(w, item); err != nil {
+				return err
+			}
+		}
+		w.WriteByte(')')
+	default:
+		return fmt.Errorf("unexpected %T in tree", tree)
+	}
+	return nil
+}
+
+// ToJSON reads a stream of S-expressions from r and writes each to w
+// as a line of JSON.
+func ToJSON(w io.Writer, r io.Reader) error {
+	dec := NewDecoder(r)
+	out := bufio.NewWriter(w)
+	for {
+		tree, err := readValue(dec)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := writeJSON(out, tree); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+func writeJSON(w *bufio.Writer, tree Value) error {
+	writeString := func(s string) {
+		data, _ := json.Marshal(s) // cannot fail
+		w.Write(data)
+	}
+	switch tree := tree.(type) {
+	case Symbol:
+		switch tree {
+		case "t":
+			w.WriteString("true")
+		case "nil":
+			w.WriteString("null")
+		case "false":
+			w.WriteString("false")
+		default:
+			w.WriteString(`{"#symbol":`)
+			writeString(string(tree))
+			w.WriteByte('}')
+		}
+	case String:
+		writeString(string(tree))
+	case Int, Float:
+		return writeTree(w, tree)
+	case Macro:
+		w.WriteByte('{')
+		writeString(tree.Name)
+		w.WriteByte(':')
+		if err := writeJSON(w, tree.Datum); err != nil {
+			return err
+		}
+		w.WriteByte('}')
+	case List:
+		object := isJSONObject(tree)
+		if object {
+			w.WriteByte('{')
+		} else {
+			w.WriteByte('[')
+		}
+		for i, item := range tree {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			if object {
+				pair := item.(List)
+				key, _ := jsonKey(pair[0])
+				writeString(key)
+				w.WriteByte(':')
+				item = pair[1]
+			}
+			if err := writeJSON(w, item); err != nil {
+				return err
+			}
+		}
+		if object {
+			w.WriteByte('}')
+		} else {
+			w.WriteByte(']')
+		}
+	default:
+		return fmt.Errorf("unexpected %T in tree", tree)
+	}
+	return nil
+}
+
+// FromJSON reads a stream of JSON values from r and writes each to w
+// as a line holding an S-expression.
+func FromJSON(w io.Writer, r io.Reader) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	out := bufio.NewWriter(w)
+	for {
+		tree, err := readJSON(dec)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := writeTree(out, tree); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// readJSON reads the next JSON value from dec as a tree, preserving
+// the order of the members of objects.
+func readJSON(dec *json.Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case nil:
+		return Symbol("nil"), nil
+	case bool:
+		if tok {
+			return Symbol("t"), nil
+		}
+		return Symbol("false"), nil
+	case string:
+		return String(tok), nil
+	case json.Number:
+		if i, err := tok.Int64(); err == nil {
+			return Int(i), nil
+		}
+		f, err := tok.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("number %s out of range", tok)
+		}
+		return Float(f), nil
+	case json.Delim:
+		list := List{}
+		if tok == '[' {
+			for dec.More() {
+				item, err := readJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, item)
+			}
+		} else {
+			var keys []string
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := readJSON(dec)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, key.(string))
+				list = append(list, value)
+			}
+			if len(keys) == 1 && isSpecial(keys[0]) {
+				if _, err := dec.Token(); err != nil { // '}'
+					return nil, err
+				}
+				return readSpecial(keys[0], list[0])
+			}
+			for i, key := range keys {
+				list[i] = List{readKey(key), list[i]}
+			}
+		}
+		if _, err := dec.Token(); err != nil { // ']' or '}'
+			return nil, err
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected JSON token %v", tok)
+}
+
+// isSpecial reports whether key is the key of a JSON object that
+// stands for a symbol or a reader macro: #symbol, #C, or a label #n=.
+// Objects with other keys, even those that begin with #, are lists
+// of pairs.
+func isSpecial(key string) bool {
+	if key == "#symbol" || key == "#C" {
+		return true
+	}
+	n := strings.TrimSuffix(strings.TrimPrefix(key, "#"), "=")
+	if len(n) != len(key)-2 || n == "" {
+		return false
+	}
+	for _, r := range n {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// readSpecial returns the symbol or macro of the JSON object {key: value}.
+func readSpecial(key string, value Value) (Value, error) {
+	if key == "#symbol" {
+		if name, ok := value.(String); ok {
+			return Symbol(name), nil
+		}
+		return nil, fmt.Errorf(`"#symbol" must name a symbol, not %v`, value)
+	}
+	return Macro{key, value}, nil
+}
+
+// ToXML reads a stream of S-expressions from r and writes each to w as
+// an XML element on a line of its own.
+func ToXML(w io.Writer, r io.Reader) error {
+	dec := NewDecoder(r)
+	enc := xml.NewEncoder(w)
+	for {
+		tree, err := readValue(dec)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := writeXML(enc, tree); err != nil {
+			return err
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeXML(enc *xml.Encoder, tree Value) error {
+	element := func(name string, attr []xml.Attr, content func() error) error {
+		start := xml.StartElement{Name: xml.Name{Local: name}, Attr: attr}
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := content(); err != nil {
+			return err
+		}
+		return enc.EncodeToken(start.End())
+	}
+	text := func(s string) func() error {
+		return func() error { return enc.EncodeToken(xml.CharData(s)) }
+	}
+	switch tree := tree.(type) {
+	case Symbol:
+		return element("symbol", nil, text(string(tree)))
+	case String:
+		return element("string", nil, text(string(tree)))
+	case Int:
+		return element("int", nil, text(strconv.FormatInt(int64(tree), 10)))
+	case Float:
+		s, err := formatFloat(float64(tree), 64)
+		if err != nil {
+			return err
+		}
+		return element("float", nil, text(s))
+	case Macro:
+		attr := []xml.Attr{{Name: xml.Name{Local: "name"}, Value: tree.Name}}
+		return element("macro", attr, func() error { return writeXML(enc, tree.Datum) })
+	case List:
+		if isObject(tree) {
+			return element("object", nil, func() error {
+				for _, item := range tree {
+					pair := item.(List)
+					name := string(pair[0].(Symbol))
+					if err := element(name, nil, func() error { return writeXML(enc, pair[1]) }); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+		return element("list", nil, func() error {
+			for _, item := range tree {
+				if err := writeXML(enc, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return fmt.Errorf("unexpected %T in tree", tree)
+}
+
+// FromXML reads a stream of XML elements from r and writes each to w
+// as a line holding an S-expression.
+func FromXML(w io.Writer, r io.Reader) error {
+	dec := xml.NewDecoder(r)
+	out := bufio.NewWriter(w)
+	for {
+		start, err := nextElement(dec)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		tree, err := readXML(dec, start)
+		if err != nil {
+			return err
+		}
+		if err := writeTree(out, tree); err != nil {
+			return err
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// errEndElement is returned by nextElement at the end of the enclosing
+// element.
+var errEndElement = fmt.Errorf("end of element")
+
+// nextElement returns the start of the next element from dec, skipping
+// white space, comments and processing instructions.
+func nextElement(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			return tok, nil
+		case xml.EndElement:
+			return xml.StartElement{}, errEndElement
+		case xml.CharData:
+			if len(strings.TrimSpace(string(tok))) > 0 {
+				return xml.StartElement{}, fmt.Errorf("unexpected text %q", tok)
+			}
+		}
+	}
+}
+
+// readXML reads the content of the element that begins with start,
+// and its end, as a tree.
+func readXML(dec *xml.Decoder, start xml.StartElement) (Value, error) {
+	switch name := start.Name.Local; name {
+	case "symbol", "string", "int", "float":
+		var s string
+		if err := dec.DecodeElement(&s, &start); err != nil {
+			return nil, err
+		}
+		switch name {
+		case "symbol":
+			return Symbol(s), nil
+		case "string":
+			return String(s), nil
+		case "int":
+			i, err := strconv.ParseInt(s, 10, 64)
+			return Int(i), err
+		default:
+			f, err := strconv.ParseFloat(s, 64)
+			return Float(f), err
+		}
+
+	case "macro":
+		var datum Value
+		err := readChildren(dec, func(child xml.StartElement) error {
+			if datum != nil {
+				return fmt.Errorf("macro has more than one value")
+			}
+			var err error
+			datum, err = readXML(dec, child)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range start.Attr {
+			if attr.Name.Local == "name" && datum != nil {
+				return Macro{attr.Value, datum}, nil
+			}
+		}
+		return nil, fmt.Errorf("macro needs a name and a value")
+
+	case "object", "list":
+		list := List{}
+		err := readChildren(dec, func(child xml.StartElement) error {
+			if name == "list" {
+				item, err := readXML(dec, child)
+				list = append(list, item)
+				return err
+			}
+			// <field>value</field>
+			var value Value
+			err := readChildren(dec, func(v xml.StartElement) error {
+				if value != nil {
+					return fmt.Errorf("field %s has more than one value", child.Name.Local)
+				}
+				var err error
+				value, err = readXML(dec, v)
+				return err
+			})
+			if err == nil && value == nil {
+				err = fmt.Errorf("field %s has no value", child.Name.Local)
+			}
+			list = append(list, List{Symbol(child.Name.Local), value})
+			return err
+		})
+		return list, err
+	}
+	return nil, fmt.Errorf("unexpected element <%s>", start.Name.Local)
+}
+
+// readChildren calls f for the start of each child of the current
+// element, up to the element's end.
+func readChildren(dec *xml.Decoder, f func(xml.StartElement) error) error {
+	for {
+		child, err := nextElement(dec)
+		if err == errEndElement {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := f(child); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package sexpr
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	for _, test := range []struct {
+		sexpr, json, xml string
+	}{
+		{`"a\"b"`, `"a\"b"`, `<string>a&#34;b</string>`},
+		{`-42`, `-42`, `<int>-42</int>`},
+		{`1.5e+21`, `1.5e+21`, `<float>1.5e+21</float>`},
+		{`t`, `true`, `<symbol>t</symbol>`},
+		{`nil`, `null`, `<symbol>nil</symbol>`},
+		{`foo`, `{"#symbol":"foo"}`, `<symbol>foo</symbol>`},
+		{`()`, `[]`, `<list></list>`},
+		{`(1 "x" (nil))`, `[1,"x",[null]]`,
+			`<list><int>1</int><string>x</string><list><symbol>nil</symbol></list></list>`},
+		{`((Title "Bullitt") (Year 1968))`, `{"Title":"Bullitt","Year":1968}`,
+			`<object><Title><string>Bullitt</string></Title><Year><int>1968</int></Year></object>`},
+		{`(("key" 1))`, `{"\"key\"":1}`,
+			`<list><list><string>key</string><int>1</int></list></list>`},
+		{`((Actor (("Dr. Strangelove" "Peter Sellers"))))`,
+			`{"Actor":{"Dr. Strangelove":"Peter Sellers"}}`,
+			`<object><Actor><list><list><string>Dr. Strangelove</string><string>Peter Sellers</string></list></list></Actor></object>`},
+		{`(("\"key\"" 1) ("#C" 2))`, `{"\"\\\"key\\\"\"":1,"#C":2}`,
+			`<list><list><string>&#34;key&#34;</string><int>1</int></list><list><string>#C</string><int>2</int></list></list>`},
+		{`(("#C" 1))`, `[["#C",1]]`,
+			`<list><list><string>#C</string><int>1</int></list></list>`},
+		{`false`, `false`, `<symbol>false</symbol>`},
+		{`((t 1))`, `[[true,1]]`,
+			`<list><list><symbol>t</symbol><int>1</int></list></list>`},
+		{`#C(1 -2)`, `{"#C":[1,-2]}`,
+			`<macro name="#C"><list><int>1</int><int>-2</int></list></macro>`},
+		{`((A #1=((B #1#))))`, `{"A":{"#1=":{"B":{"#symbol":"#1#"}}}}`,
+			`<object><A><macro name="#1="><object><B><symbol>#1#</symbol></B></object></macro></A></object>`},
+	} {
+		for _, conv := range []struct {
+			name     string
+			to, from func(w io.Writer, r io.Reader) error
+			want     string
+		}{
+			{"JSON", ToJSON, FromJSON, test.json},
+			{"XML", ToXML, FromXML, test.xml},
+		} {
+			var out bytes.Buffer
+			if err := conv.to(&out, strings.NewReader(test.sexpr)); err != nil {
+				t.Errorf("To%s(%s): %v", conv.name, test.sexpr, err)
+				continue
+			}
+			if got := strings.TrimSpace(out.String()); got != conv.want {
+				t.Errorf("To%s(%s) = %s, want %s", conv.name, test.sexpr, got, conv.want)
+			}
+			var back bytes.Buffer
+			if err := conv.from(&back, &out); err != nil {
+				t.Errorf("From%s(%s): %v", conv.name, conv.want, err)
+				continue
+			}
+			if got := strings.TrimSpace(back.String()); got != test.sexpr {
+				t.Errorf("From%s(%s) = %s, want %s", conv.name, conv.want, got, test.sexpr)
+			}
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	const input = `{"name": "x", "not a symbol": false, "n": 1.0, "big": 1e400}`
+	var out bytes.Buffer
+	if err := FromJSON(&out, strings.NewReader(input)); err == nil {
+		t.Errorf("FromJSON(%s) = %s, want out of range error", input, out.String())
+	}
+	out.Reset()
+	const input2 = `{"name": "x", "not a symbol": false, "n": 1.0} [] {}`
+	const want = `((name "x") ("not a symbol" false) (n 1.0))
+()
+()
+`
+	if err := FromJSON(&out, strings.NewReader(input2)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Errorf("FromJSON(%s) = %s, want %s", input2, out.String(), want)
+	}
+	// JSON objects convert back unchanged, whatever their keys.
+	for _, input := range []string{
+		`{"max results":10,"max-results":false,"ok":true,"none":null}`,
+		`{"\"x\"":1,"\"\\\"y\\\"\"":2,"\"a b\"":3,"'z'":4,"\"\\u0041\"":5}`,
+		`{"#tag":{"#1":[],"#=":1}}`,
+	} {
+		var sexpr, json bytes.Buffer
+		if err := FromJSON(&sexpr, strings.NewReader(input)); err != nil {
+			t.Errorf("FromJSON(%s): %v", input, err)
+			continue
+		}
+		if err := ToJSON(&json, &sexpr); err != nil {
+			t.Errorf("ToJSON(FromJSON(%s)): %v", input, err)
+			continue
+		}
+		if got := strings.TrimSpace(json.String()); got != input {
+			t.Errorf("ToJSON(FromJSON(%s)) = %s", input, got)
+		}
+	}
+	// Only #symbol, #C and labels are special keys.
+	for _, test := range []struct{ input, want string }{
+		{`{"#tag": 1}`, `(("#tag" 1))`},
+		{`{"#1": 1}`, `(("#1" 1))`},
+		{`{"#=": 1}`, `(("#=" 1))`},
+		{`{"#2=": [1]}`, `#2=(1)`},
+	} {
+		out.Reset()
+		if err := FromJSON(&out, strings.NewReader(test.input)); err != nil {
+			t.Errorf("FromJSON(%s): %v", test.input, err)
+			continue
+		}
+		if got := strings.TrimSpace(out.String()); got != test.want {
+			t.Errorf("FromJSON(%s) = %s, want %s", test.input, got, test.want)
+		}
+		if err := ToJSON(io.Discard, &out); err != nil {
+			t.Errorf("ToJSON(FromJSON(%s)): %v", test.input, err)
+		}
+	}
+	for _, input := range []string{`{"#symbol": 1}`, `[1,`, `{"a" 1}`} {
+		if err := FromJSON(&out, strings.NewReader(input)); err == nil {
+			t.Errorf("FromJSON(%s) succeeded, want error", input)
+		}
+	}
+	for _, input := range []string{
+		`<int>x</int>`,
+		`<macro><int>1</int></macro>`,
+		`<object><A></A></object>`,
+		`<vector></vector>`,
+		`<list>text</list>`,
+	} {
+		if err := FromXML(&out, strings.NewReader(input)); err == nil {
+			t.Errorf("FromXML(%s) succeeded, want error", input)
+		}
+	}
+	for _, input := range []string{`(1 2`, `)`, `(#C)`} {
+		if err := ToJSON(&out, strings.NewReader(input)); err == nil {
+			t.Errorf("ToJSON(%s) succeeded, want error", input)
+		}
+	}
+}
@@ -5,141 +5,457 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 // Unmarshal parses S-expression data and populates the variable
-// whose address is in the non-nil pointer out.
-func Unmarshal(data []byte, out interface{}) (err error) {
-	lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
-	lex.scan.Init(bytes.NewReader(data))
-	lex.next() // get the first token
-	defer func() {
-		// NOTE: this is not an example of ideal error handling.
-		if x := recover(); x != nil {
-			err = fmt.Errorf("error at %s: %v", lex.scan.Position, x)
-		}
-	}()
-	read(lex, reflect.ValueOf(out).Elem())
-	return nil
+// whose address is in the non-nil pointer out. The data must hold
+// exactly one value.
+//
+// Unmarshal ignores fields of the input that the struct does not
+// have; use a Decoder with DisallowUnknownFields to reject them.
+func Unmarshal(data []byte, out interface{}) error {
+	dec := NewDecoder(bytes.NewReader(data))
+	if err := dec.Decode(out); err != nil {
+		return err
+	}
+	if dec.peek() != scanner.EOF {
+		return dec.lex.syntaxError("unexpected %s after value", dec.lex.describe())
+	}
+	return dec.lex.err
+}
+
+// A SyntaxError describes malformed S-expression input.
+type SyntaxError struct {
+	Pos scanner.Position // position of the offending token
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Pos, e.Msg)
+}
+
+// An UnmarshalTypeError describes an S-expression value that could not
+// be stored in a Go variable of the given type, either because it is
+// the wrong kind of value or because it is out of range.
+type UnmarshalTypeError struct {
+	Pos   scanner.Position // position of the value
+	Value string           // description of the value, such as "list" or "number 300"
+	Type  reflect.Type     // type of the Go variable
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return fmt.Sprintf("%s: cannot unmarshal %s into Go value of type %s",
+		e.Pos, e.Value, e.Type)
 }
 
 //!+lexer
 type lexer struct {
-	scan  scanner.Scanner
-	token rune // the current token
+	scan     scanner.Scanner
+	token    rune     // the current token
+	err      error    // the first error reported by the scanner
+	lisp     bool     // accept Lisp syntax (see Decoder.UseLispSyntax)
+	comments []string // text of the ; comments before token, in Lisp syntax
+	depth    int      // number of lists open before token
+}
+
+// unread is the token after the ) that ends a top-level list, which is
+// not scanned until it is needed, so that a value read from a stream
+// such as a pipe is complete without waiting for the next one.
+const unread = scanner.Comment - 1
+
+// maxDepth is the limit on the nesting of lists, beyond which the
+// recursion of the decoder would overflow the stack.
+const maxDepth = 10000
+
+func (lex *lexer) next() {
+	switch lex.token {
+	case '(':
+		if lex.depth++; lex.depth > maxDepth {
+			if lex.err == nil {
+				lex.err = &SyntaxError{lex.scan.Position, fmt.Sprintf("lists nested more than %d deep", maxDepth)}
+			}
+			lex.token = scanner.EOF
+			return
+		}
+	case ')':
+		if lex.depth--; lex.depth == 0 {
+			lex.token = unread
+			return
+		}
+	}
+	lex.token = lex.scan.Scan()
+	lex.comments = nil
+	for lex.lisp && lex.token == ';' {
+		lex.comments = append(lex.comments, lex.comment())
+		lex.token = lex.scan.Scan()
+	}
 }
 
-func (lex *lexer) next()        { lex.token = lex.scan.Scan() }
 func (lex *lexer) text() string { return lex.scan.TokenText() }
 
-func (lex *lexer) consume(want rune) {
-	if lex.token != want { // NOTE: Not an example of good error handling.
-		panic(fmt.Sprintf("got %q, want %q", lex.text(), want))
+func (lex *lexer) consume(want rune) error {
+	if lex.token != want {
+		return lex.syntaxError("got %s, want %q", lex.describe(), want)
 	}
 	lex.next()
+	return lex.err
 }
 
 //!-lexer
 
-// The read function is a decoder for a small subset of well-formed
-// S-expressions. For brevity of our example, it takes many dubious
-// shortcuts.
+// comment returns the rest of the line after a ';', which is a
+// comment in Lisp syntax.
+func (lex *lexer) comment() string {
+	var text strings.Builder
+	for ch := lex.scan.Peek(); ch != '\n' && ch != scanner.EOF; ch = lex.scan.Peek() {
+		text.WriteRune(lex.scan.Next())
+	}
+	return strings.TrimRight(text.String(), " \t\r")
+}
+
+// isLispIdentRune reports whether ch may be the ith rune of a symbol
+// in Lisp syntax, which, unlike Go, allows symbols such as max-results
+// and list->vector.
+func isLispIdentRune(ch rune, i int) bool {
+	return unicode.IsLetter(ch) || ch == '_' ||
+		i > 0 && (unicode.IsDigit(ch) || strings.ContainsRune("-+*/<>=!?.", ch))
+}
+
+// describe returns a description of the current token for errors.
+func (lex *lexer) describe() string {
+	if lex.token == scanner.EOF {
+		return "end of input"
+	}
+	return strconv.Quote(lex.text())
+}
+
+func (lex *lexer) syntaxError(format string, args ...interface{}) error {
+	return &SyntaxError{lex.scan.Position, fmt.Sprintf(format, args...)}
+}
+
+func (lex *lexer) typeError(value string, t reflect.Type) error {
+	return &UnmarshalTypeError{lex.scan.Position, value, t}
+}
+
+// The read method is a decoder for a small subset of S-expressions.
+// It reports malformed input as a SyntaxError and input that does not
+// fit v as an UnmarshalTypeError.
 //
 // The parser assumes
-// - that the S-expression input is well-formed; it does no error checking.
-// - that the S-expression input corresponds to the type of the variable.
-// - that all numbers in the input are non-negative decimal integers.
-// - that all keys in ((key value) ...) struct syntax are unquoted symbols.
+// - that all numbers in the input are decimal.
+// - that all keys in ((key value) ...) struct syntax are unquoted symbols
+//   naming fields of the struct, ignoring case and, for symbols such
+//   as max-results in Lisp syntax, dashes.
 // - that the input does not contain dotted lists such as (1 2 . 3).
-// - that the input does not contain Lisp reader macros such 'x and #'x.
+// - that the input does not contain Lisp reader macros such as #'x;
+//   the only ones it accepts are #C(real imag) for complex numbers,
+//   the datum labels #n= and #n# of shared pointers (see labels.go),
+//   and, in Lisp syntax, the quote 'x, which it ignores.
 //
 // The reflection logic assumes
-// - that v is always a variable of the appropriate type for the
-//   S-expression value.  For example, v must not be a boolean,
-//   interface, channel, or function, and if v is an array, the input
-//   must have the correct number of elements.
 // - that v in the top-level call to read has the zero value of its
 //   type and doesn't need clearing.
-// - that if v is a numeric variable, it is a signed integer.
-func read(lex *lexer, v reflect.Value) {
+// - that the dynamic type of every ("type" value) interface value
+//   has been registered with Register.
+//
+// Variables whose types implement Unmarshaler, or have a built-in
+// decoding (see marshal.go), decode themselves, and variables of type
+// Value accept any input (see value.go).
+func (dec *Decoder) read(v reflect.Value) error {
+	lex := dec.lex
+	if lex.err != nil {
+		return lex.err
+	}
+	if isValueType(v.Type()) {
+		return dec.readGeneric(v)
+	}
+	if ok, err := dec.unmarshal(v); ok {
+		return err
+	}
+	if lex.token == '#' {
+		return dec.readMacro(v)
+	}
+	if v.Kind() == reflect.Ptr && !(lex.token == scanner.Ident && lex.text() == "nil") {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return dec.read(v.Elem())
+	}
 	switch lex.token {
 	case scanner.Ident:
 		// The only valid identifiers are
-		// "nil" and struct field names.
-		if lex.text() == "nil" {
+		// "nil", "t" and struct field names.
+		switch lex.text() {
+		case "nil":
 			v.Set(reflect.Zero(v.Type()))
 			lex.next()
-			return
+			return nil
+		case "t":
+			if v.Kind() != reflect.Bool {
+				return lex.typeError("t", v.Type())
+			}
+			v.SetBool(true)
+			lex.next()
+			return nil
 		}
+		return lex.syntaxError("unexpected symbol %s", lex.text())
 	case scanner.String:
-		s, _ := strconv.Unquote(lex.text()) // NOTE: ignoring errors
+		s, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return lex.syntaxError("malformed string %s", lex.text())
+		}
+		if v.Kind() != reflect.String {
+			return lex.typeError("string", v.Type())
+		}
 		v.SetString(s)
 		lex.next()
-		return
-	case scanner.Int:
-		i, _ := strconv.Atoi(lex.text()) // NOTE: ignoring errors
-		v.SetInt(int64(i))
-		lex.next()
-		return
+		return nil
+	case scanner.Int, scanner.Float, '-':
+		return dec.readNumber(v)
 	case '(':
 		lex.next()
-		readList(lex, v)
-		lex.next() // consume ')'
-		return
+		if err := dec.readList(v); err != nil {
+			return err
+		}
+		return lex.consume(')')
+	case '\'': // 'x, in Lisp syntax
+		lex.next()
+		return dec.read(v)
 	}
-	panic(fmt.Sprintf("unexpected token %q", lex.text()))
+	return lex.syntaxError("unexpected %s", lex.describe())
 }
 
-func readList(lex *lexer, v reflect.Value) {
+// readMacro reads a value that begins with '#': a complex number
+// #C(real imag), a labeled value #n=value, or a reference #n# to the
+// value labeled n. Only pointers may be labeled.
+func (dec *Decoder) readMacro(v reflect.Value) error {
+	lex := dec.lex
+	pos := lex.scan.Position
+	lex.next()
+	switch {
+	case lex.token == scanner.Ident && lex.text() == "C":
+		for v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Complex64 && v.Kind() != reflect.Complex128 {
+			return &UnmarshalTypeError{pos, "complex number", v.Type()}
+		}
+		lex.next()
+		if err := lex.consume('('); err != nil {
+			return err
+		}
+		parts := reflect.New(reflect.ArrayOf(2, floatType(v.Type().Bits()/2))).Elem()
+		for i := 0; i < 2; i++ {
+			if err := dec.read(parts.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.SetComplex(complex(parts.Index(0).Float(), parts.Index(1).Float()))
+		return lex.consume(')')
+
+	case lex.token == scanner.Int:
+		n := lex.text()
+		lex.next()
+		switch lex.token {
+		case '=': // #n=value
+			if v.Kind() != reflect.Ptr {
+				return &UnmarshalTypeError{pos, "labeled value", v.Type()}
+			}
+			lex.next()
+			p := reflect.New(v.Type().Elem())
+			dec.labels[n] = p
+			v.Set(p)
+			return dec.read(p.Elem())
+		case '#': // #n#
+			p, ok := dec.labels[n]
+			if !ok {
+				return &SyntaxError{pos, fmt.Sprintf("undefined label #%s#", n)}
+			}
+			if !p.Type().AssignableTo(v.Type()) {
+				return &UnmarshalTypeError{pos, "reference to " + p.Type().String(), v.Type()}
+			}
+			v.Set(p)
+			lex.next()
+			return lex.err
+		}
+		return lex.syntaxError("got %s after #%s, want = or #", lex.describe(), n)
+	}
+	return lex.syntaxError("got #%s, want #C or #n", lex.text())
+}
+
+// floatType returns the float type of the given bit size.
+func floatType(bits int) reflect.Type {
+	if bits == 32 {
+		return reflect.TypeOf(float32(0))
+	}
+	return reflect.TypeOf(float64(0))
+}
+
+// readNumber reads an optionally negated integer or float into the
+// numeric variable v, reporting values that do not fit.
+func (dec *Decoder) readNumber(v reflect.Value) error {
+	lex := dec.lex
+	pos := lex.scan.Position
+	text := ""
+	if lex.token == '-' {
+		text = "-"
+		lex.next()
+		if lex.token != scanner.Int && lex.token != scanner.Float {
+			return lex.syntaxError("got %s after -, want number", lex.describe())
+		}
+	}
+	text += lex.text()
+	var ok bool
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16,
+		reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, 64)
+		if ok = err == nil && !v.OverflowInt(i); ok {
+			v.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16,
+		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(text, 10, 64)
+		if ok = err == nil && !v.OverflowUint(u); ok {
+			v.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if ok = err == nil; ok {
+			v.SetFloat(f)
+		}
+	}
+	if !ok {
+		return &UnmarshalTypeError{pos, "number " + text, v.Type()}
+	}
+	lex.next()
+	return lex.err
+}
+
+func (dec *Decoder) readList(v reflect.Value) error {
+	lex := dec.lex
 	switch v.Kind() {
 	case reflect.Array: // (item ...)
-		for i := 0; !endList(lex); i++ {
-			read(lex, v.Index(i))
+		for i := 0; ; i++ {
+			if end, err := dec.endList(); end || err != nil {
+				return err
+			}
+			if i == v.Len() {
+				return lex.typeError(fmt.Sprintf("list of more than %d elements", i), v.Type())
+			}
+			if err := dec.read(v.Index(i)); err != nil {
+				return err
+			}
 		}
 
 	case reflect.Slice: // (item ...)
-		for !endList(lex) {
+		for {
+			if end, err := dec.endList(); end || err != nil {
+				return err
+			}
 			item := reflect.New(v.Type().Elem()).Elem()
-			read(lex, item)
+			if err := dec.read(item); err != nil {
+				return err
+			}
 			v.Set(reflect.Append(v, item))
 		}
 
 	case reflect.Struct: // ((name value) ...)
-		for !endList(lex) {
-			lex.consume('(')
+		for {
+			if end, err := dec.endList(); end || err != nil {
+				return err
+			}
+			if err := lex.consume('('); err != nil {
+				return err
+			}
 			if lex.token != scanner.Ident {
-				panic(fmt.Sprintf("got token %q, want field name", lex.text()))
+				return lex.syntaxError("got %s, want field name", lex.describe())
 			}
 			name := lex.text()
+			f, ok := lookupField(v.Type(), name)
+			if !ok && dec.disallowUnknownFields {
+				return lex.typeError("unknown field "+name, v.Type())
+			}
 			lex.next()
-			read(lex, v.FieldByName(name))
-			lex.consume(')')
+			var err error
+			if ok {
+				err = dec.read(v.Field(f.index))
+			} else {
+				_, err = dec.readRaw() // skip the value
+			}
+			if err != nil {
+				return err
+			}
+			if err := lex.consume(')'); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Interface: // ("type" value)
+		if lex.token != scanner.String {
+			return lex.syntaxError("got %s, want type name", lex.describe())
+		}
+		name, err := strconv.Unquote(lex.text())
+		if err != nil {
+			return lex.syntaxError("malformed string %s", lex.text())
 		}
+		t, ok := lookup(name)
+		if !ok || !t.AssignableTo(v.Type()) {
+			return lex.typeError("value of type "+name, v.Type())
+		}
+		lex.next()
+		item := reflect.New(t).Elem()
+		if err := dec.read(item); err != nil {
+			return err
+		}
+		if end, err := dec.endList(); err != nil {
+			return err
+		} else if !end {
+			return lex.syntaxError("got %s after value of type %s, want )", lex.describe(), name)
+		}
+		v.Set(item)
+		return nil
 
 	case reflect.Map: // ((key value) ...)
 		v.Set(reflect.MakeMap(v.Type()))
-		for !endList(lex) {
-			lex.consume('(')
+		for {
+			if end, err := dec.endList(); end || err != nil {
+				return err
+			}
+			if err := lex.consume('('); err != nil {
+				return err
+			}
 			key := reflect.New(v.Type().Key()).Elem()
-			read(lex, key)
+			if err := dec.read(key); err != nil {
+				return err
+			}
 			value := reflect.New(v.Type().Elem()).Elem()
-			read(lex, value)
+			if err := dec.read(value); err != nil {
+				return err
+			}
 			v.SetMapIndex(key, value)
-			lex.consume(')')
+			if err := lex.consume(')'); err != nil {
+				return err
+			}
 		}
-
-	default:
-		panic(fmt.Sprintf("cannot decode list into %v", v.Type()))
 	}
+	return lex.typeError("list", v.Type())
 }
 
-func endList(lex *lexer) bool {
-	switch lex.token {
-	case scanner.EOF:
-		panic("end of file")
-	case ')':
-		return true
+// endList reports whether the current token closes a list.
+func (dec *Decoder) endList() (bool, error) {
+	lex := dec.lex
+	switch {
+	case lex.err != nil:
+		return false, lex.err
+	case lex.token == scanner.EOF:
+		return false, lex.syntaxError("unexpected end of input")
 	}
-	return false
+	return lex.token == ')', nil
 }
@@ -5,20 +5,63 @@ package sexpr
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 // Marshal encodes a Go value in S-expression form.
+//
+// A struct is encoded as a list of (name value) pairs of its exported
+// fields, named as directed by their sexpr or json tags (see fields.go).
+// Unexported fields are omitted, as encoding/json omits them, and so
+// are not restored by Unmarshal.
+//
+// The output is canonical: the entries of a map are sorted by the
+// encoded form of their keys, so equal values always have the same
+// encoding, which may be hashed or compared. An Encoder may leave them
+// unsorted instead; see Encoder.SetCanonical.
 func Marshal(v interface{}) ([]byte, error) {
 	var buf bytes.Buffer
-	if err := encode(&buf, reflect.ValueOf(v)); err != nil {
+	rv := reflect.ValueOf(v)
+	l, err := newLabels(rv)
+	if err != nil {
+		return nil, err
+	}
+	if err := encode(&buf, rv, &encodeState{labels: l}); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
-// encode writes to buf an S-expression representation of v.
-func encode(buf *bytes.Buffer, v reflect.Value) error {
+// An encodeState holds the state of one call of encode: the labels of
+// its shared pointers, and its treatment of maps.
+type encodeState struct {
+	*labels
+	unsorted bool // write map entries in iteration order
+}
+
+// A writer is the output of encode and of the pretty printer: a
+// bytes.Buffer for Marshal, or a bufio.Writer for an Encoder.
+type writer interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+// encode writes to buf an S-expression representation of v, labeling
+// the values of shared pointers with l.
+func encode(buf writer, v reflect.Value, l *encodeState) error {
+	if data, ok, err := marshal(v); ok {
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		return nil
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		buf.WriteString("nil")
@@ -31,11 +74,67 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		fmt.Fprintf(buf, "%d", v.Uint())
 
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteString("t")
+		} else {
+			buf.WriteString("nil")
+		}
+
+	case reflect.Float32, reflect.Float64:
+		s, err := formatFloat(v.Float(), v.Type().Bits())
+		if v.Type() == floatValueType {
+			s, err = formatFloatValue(Float(v.Float()))
+		}
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+
+	case reflect.Complex64, reflect.Complex128: // #C(real imag)
+		s, err := formatComplex(v.Complex(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+
 	case reflect.String:
+		if v.Type() == symbolType {
+			buf.WriteString(v.String())
+			break
+		}
+		if v.Type() == commentType { // ;text, in Lisp syntax
+			fmt.Fprintf(buf, ";%s\n", v.String())
+			break
+		}
 		fmt.Fprintf(buf, "%q", v.String())
 
 	case reflect.Ptr:
-		return encode(buf, v.Elem())
+		if v.IsNil() {
+			buf.WriteString("nil")
+			break
+		}
+		if n, written := l.label(v); written {
+			fmt.Fprintf(buf, "#%d#", n)
+			break
+		} else if n > 0 {
+			fmt.Fprintf(buf, "#%d=", n)
+		}
+		return encode(buf, v.Elem(), l)
+
+	case reflect.Interface: // ("type" value)
+		if v.IsNil() {
+			buf.WriteString("nil")
+			break
+		}
+		if v.Type() == valueType {
+			return encode(buf, v.Elem(), l)
+		}
+		fmt.Fprintf(buf, "(%q ", v.Elem().Type())
+		if err := encode(buf, v.Elem(), l); err != nil {
+			return err
+		}
+		buf.WriteByte(')')
 
 	case reflect.Array, reflect.Slice: // (value ...)
 		buf.WriteByte('(')
@@ -43,20 +142,30 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
-			if err := encode(buf, v.Index(i)); err != nil {
+			if err := encode(buf, v.Index(i), l); err != nil {
 				return err
 			}
 		}
 		buf.WriteByte(')')
 
 	case reflect.Struct: // ((name value) ...)
+		if v.Type() == macroType {
+			buf.WriteString(v.Field(0).String())
+			return encode(buf, v.Field(1), l)
+		}
 		buf.WriteByte('(')
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range fields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			if sep {
 				buf.WriteByte(' ')
 			}
-			fmt.Fprintf(buf, "(%s ", v.Type().Field(i).Name)
-			if err := encode(buf, v.Field(i)); err != nil {
+			sep = true
+			fmt.Fprintf(buf, "(%s ", f.name)
+			if err := encode(buf, fv, l); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
@@ -64,25 +173,92 @@ func encode(buf *bytes.Buffer, v reflect.Value) error {
 		buf.WriteByte(')')
 
 	case reflect.Map: // ((key value) ...)
+		keys, err := mapKeys(v, !l.unsorted)
+		if err != nil {
+			return err
+		}
 		buf.WriteByte('(')
-		for i, key := range v.MapKeys() {
+		for i, key := range keys {
 			if i > 0 {
 				buf.WriteByte(' ')
 			}
 			buf.WriteByte('(')
-			if err := encode(buf, key); err != nil {
+			if err := encode(buf, key.v, l); err != nil {
 				return err
 			}
 			buf.WriteByte(' ')
-			if err := encode(buf, v.MapIndex(key)); err != nil {
+			if err := encode(buf, v.MapIndex(key.v), l); err != nil {
 				return err
 			}
 			buf.WriteByte(')')
 		}
 		buf.WriteByte(')')
 
-	default: // float, complex, bool, chan, func, interface
+	default: // chan, func, unsafe pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
 }
+
+// A mapKey is a key of a map and its encoding.
+type mapKey struct {
+	v    reflect.Value
+	data []byte
+}
+
+// mapKeys returns the keys of map v, sorted by their encodings without
+// labels if sorted is set, and otherwise in iteration order, without
+// their encodings.
+func mapKeys(v reflect.Value, sorted bool) ([]mapKey, error) {
+	keys := make([]mapKey, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		if !sorted {
+			keys = append(keys, mapKey{key, nil})
+			continue
+		}
+		var buf bytes.Buffer
+		if err := encode(&buf, key, &encodeState{labels: new(labels)}); err != nil {
+			return nil, err
+		}
+		keys = append(keys, mapKey{key, buf.Bytes()})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i].data, keys[j].data) < 0
+	})
+	return keys, nil
+}
+
+// formatFloat returns the shortest decimal form of f that reads back
+// as the same float of the given bit size. Infinities and NaN have no
+// S-expression form.
+func formatFloat(f float64, bits int) (string, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("unsupported value: %g", f)
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits), nil
+}
+
+// formatFloatValue is like formatFloat for a Float, but keeps a
+// decimal point in an integral value, writing 2.0 rather than 2, so
+// that the value reads back as a Float and not an Int.
+func formatFloatValue(f Float) (string, error) {
+	s, err := formatFloat(float64(f), 64)
+	if err == nil && !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s, err
+}
+
+// formatComplex returns the Common Lisp form #C(real imag) of c, whose
+// parts are floats of half the given bit size.
+func formatComplex(c complex128, bits int) (string, error) {
+	re, err := formatFloat(real(c), bits/2)
+	if err != nil {
+		return "", err
+	}
+	im, err := formatFloat(imag(c), bits/2)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("#C(%s %s)", re, im), nil
+}
@@ -0,0 +1,90 @@
+package sexpr
+
+import (
+	"reflect"
+	"strings"
+)
+
+// A field describes how a struct field is encoded.
+type field struct {
+	name      string // effective name
+	index     int    // index in the struct
+	omitEmpty bool   // omit the field if it has the zero value
+}
+
+// fields returns the encoded fields of struct type t, in order.
+//
+// The effective name of a field is taken from its sexpr tag, or failing
+// that its json tag, or failing that the field name itself. A tag of
+// "-" drops the field, and the ",omitempty" option omits it when its
+// value is empty. Unexported fields are never encoded.
+func fields(t reflect.Type) []field {
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		fieldInfo := t.Field(i) // a reflect.StructField
+		if fieldInfo.PkgPath != "" {
+			continue // unexported
+		}
+		tag, ok := fieldInfo.Tag.Lookup("sexpr")
+		if !ok {
+			tag = fieldInfo.Tag.Get("json")
+		}
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		f := field{name: opts[0], index: i}
+		if f.name == "" {
+			f.name = fieldInfo.Name
+		}
+		for _, opt := range opts[1:] {
+			if opt == "omitempty" {
+				f.omitEmpty = true
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// lookupField returns the field of struct type t with the given
+// effective name, preferring an exact match to a case-insensitive one.
+func lookupField(t reflect.Type, name string) (field, bool) {
+	var fold *field
+	for _, f := range fields(t) {
+		if f.name == name {
+			return f, true
+		}
+		if fold == nil && (strings.EqualFold(f.name, name) ||
+			strings.EqualFold(f.name, strings.Replace(name, "-", "", -1))) {
+			f := f
+			fold = &f
+		}
+	}
+	if fold == nil {
+		return field{}, false
+	}
+	return *fold, true
+}
+
+// isEmpty reports whether v is false, 0, a nil pointer or interface,
+// or an array, slice, map or string of length zero.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Values reached through more than one pointer, including those on a
+// cycle, are encoded once with a Common Lisp datum label, as in
+//
+//	((Value 1) (Next #1=((Value 2) (Next ((Value 3) (Next #1#))))))
+//
+// where #1= labels the value that follows it, and #1# refers back to
+// it. Unmarshal makes each reference point to the labeled value.
+//
+// Only pointers are labeled, so a cycle made only of maps, slices and
+// interfaces, such as a map that holds itself, cannot be encoded.
+
+// A ptrKey identifies the variable a pointer points to. A pointer to a
+// struct and a pointer to its first field have the same address but
+// different types.
+type ptrKey struct {
+	p uintptr
+	t reflect.Type
+}
+
+// labels records the pointers that an encoding refers to more than
+// once, and the labels assigned to them as they are written.
+type labels struct {
+	shared map[ptrKey]int // label of each shared pointer, or 0 if not yet written
+	next   int            // the last label assigned
+
+	lists map[listKey]bool // maps and slices being walked
+	err   error            // a cycle of maps and slices
+}
+
+// A listKey identifies the elements of a map or slice.
+type listKey struct {
+	ptrKey
+	n int // the length of a slice
+}
+
+// newLabels returns the labels needed to encode v, or an error if v
+// holds a cycle that cannot be labeled.
+func newLabels(v reflect.Value) (*labels, error) {
+	l := &labels{shared: make(map[ptrKey]int), lists: make(map[listKey]bool)}
+	l.walk(v, make(map[ptrKey]bool))
+	if l.err != nil {
+		return nil, l.err
+	}
+	return l, nil
+}
+
+// walk finds the pointers within v that are reached more than once,
+// following the same paths as encode.
+func (l *labels) walk(v reflect.Value, seen map[ptrKey]bool) {
+	if marshaler(v) != nil || l.err != nil {
+		return // v encodes itself, or cannot be encoded
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.Len() > 0 {
+		key := listKey{ptrKey{v.Pointer(), v.Type()}, v.Len()}
+		if l.lists[key] {
+			l.err = fmt.Errorf("sexpr: cannot encode cycle through %s without a pointer", v.Type())
+			return
+		}
+		l.lists[key] = true
+		defer delete(l.lists, key)
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		key := ptrKey{v.Pointer(), v.Type()}
+		if seen[key] {
+			l.shared[key] = 0
+			return
+		}
+		seen[key] = true
+		l.walk(v.Elem(), seen)
+
+	case reflect.Interface:
+		l.walk(v.Elem(), seen)
+
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			l.walk(v.Index(i), seen)
+		}
+
+	case reflect.Struct:
+		for _, f := range fields(v.Type()) {
+			l.walk(v.Field(f.index), seen)
+		}
+
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			l.walk(key, seen)
+			l.walk(v.MapIndex(key), seen)
+		}
+	}
+}
+
+// label returns the label of the non-nil pointer v, or 0 if v is not
+// shared, and reports whether its value has already been written.
+func (l *labels) label(v reflect.Value) (n int, written bool) {
+	key := ptrKey{v.Pointer(), v.Type()}
+	n, ok := l.shared[key]
+	if !ok {
+		return 0, false
+	}
+	if n > 0 {
+		return n, true
+	}
+	l.next++
+	l.shared[key] = l.next
+	return l.next, false
+}
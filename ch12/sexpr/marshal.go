@@ -0,0 +1,207 @@
+package sexpr
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"text/scanner"
+	"time"
+)
+
+// Marshaler is the interface implemented by types that can marshal
+// themselves into a well-formed S-expression.
+type Marshaler interface {
+	MarshalSexpr() ([]byte, error)
+}
+
+// Unmarshaler is the interface implemented by types that can unmarshal
+// an S-expression of themselves. UnmarshalSexpr is given the complete
+// text of one value, which may be the symbol nil.
+type Unmarshaler interface {
+	UnmarshalSexpr([]byte) error
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+)
+
+// Standard library types that cannot have methods added are encoded by
+// these functions, as if they implemented Marshaler and Unmarshaler.
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	ipType       = reflect.TypeOf(net.IP(nil))
+
+	marshalers = map[reflect.Type]func(v interface{}) ([]byte, error){
+		timeType: func(v interface{}) ([]byte, error) {
+			return quote(v.(time.Time).Format(time.RFC3339Nano)), nil
+		},
+		durationType: func(v interface{}) ([]byte, error) {
+			return quote(v.(time.Duration).String()), nil
+		},
+		ipType: func(v interface{}) ([]byte, error) {
+			if v.(net.IP) == nil {
+				return []byte("nil"), nil
+			}
+			return quote(v.(net.IP).String()), nil
+		},
+	}
+	unmarshalers = map[reflect.Type]func(data []byte, v interface{}) error{
+		timeType: func(data []byte, v interface{}) error {
+			s, err := unquote(data)
+			if err != nil {
+				return err
+			}
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return err
+			}
+			*v.(*time.Time) = t
+			return nil
+		},
+		durationType: func(data []byte, v interface{}) error {
+			s, err := unquote(data)
+			if err != nil {
+				return err
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			*v.(*time.Duration) = d
+			return nil
+		},
+		ipType: func(data []byte, v interface{}) error {
+			s, err := unquote(data)
+			if err != nil {
+				return err
+			}
+			if s == "" {
+				*v.(*net.IP) = nil
+				return nil
+			}
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return fmt.Errorf("invalid IP address %q", s)
+			}
+			*v.(*net.IP) = ip
+			return nil
+		},
+	}
+)
+
+func quote(s string) []byte { return []byte(strconv.Quote(s)) }
+
+// unquote returns the string of a quoted S-expression string, or the
+// empty string for nil.
+func unquote(data []byte) (string, error) {
+	if string(data) == "nil" {
+		return "", nil
+	}
+	return strconv.Unquote(string(data))
+}
+
+// marshal reports whether v has a custom encoding, and if so returns
+// it.
+func marshal(v reflect.Value) ([]byte, bool, error) {
+	f := marshaler(v)
+	if f == nil {
+		return nil, false, nil
+	}
+	data, err := f()
+	return data, true, err
+}
+
+// marshaler returns the function that computes the custom encoding of
+// v, or nil if v has none. A nil pointer has none; it is always
+// encoded as nil.
+func marshaler(v reflect.Value) func() ([]byte, error) {
+	if !v.IsValid() || !v.CanInterface() ||
+		(v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil
+	}
+	if f, ok := marshalers[v.Type()]; ok {
+		return func() ([]byte, error) { return f(v.Interface()) }
+	}
+	if v.Type().Implements(marshalerType) {
+		return v.Interface().(Marshaler).MarshalSexpr
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(marshalerType) {
+		return v.Addr().Interface().(Marshaler).MarshalSexpr
+	}
+	return nil
+}
+
+// unmarshal reports whether the addressable variable v has a custom
+// decoding, and if so reads the next value into it.
+func (dec *Decoder) unmarshal(v reflect.Value) (bool, error) {
+	if !v.CanAddr() {
+		return false, nil
+	}
+	f, ok := unmarshalers[v.Type()]
+	if !ok {
+		if !v.Addr().Type().Implements(unmarshalerType) {
+			return false, nil
+		}
+		f = func(data []byte, v interface{}) error {
+			return v.(Unmarshaler).UnmarshalSexpr(data)
+		}
+	}
+	pos := dec.lex.scan.Position
+	data, err := dec.readRaw()
+	if err != nil {
+		return true, err
+	}
+	if err := f(data, v.Addr().Interface()); err != nil {
+		return true, fmt.Errorf("%s: %v: %v", pos, v.Type(), err)
+	}
+	return true, nil
+}
+
+// readRaw reads the next value and returns its text, with the
+// elements of lists separated by single spaces.
+func (dec *Decoder) readRaw() ([]byte, error) {
+	lex := dec.lex
+	var buf bytes.Buffer
+	depth := 0
+	var prev rune
+	prefix := false // prev begins an atom: '-', '\'', '#', #C or #n or #n=
+	label := false  // prev is the n of #n
+	for {
+		tok := lex.token
+		if lex.err != nil {
+			return nil, lex.err
+		}
+		switch {
+		case tok == scanner.EOF:
+			return nil, lex.syntaxError("unexpected end of input")
+		case tok == ')' && depth == 0:
+			return nil, lex.syntaxError("unexpected %s", lex.describe())
+		}
+		if buf.Len() > 0 && tok != ')' && prev != '(' && !prefix {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(lex.text())
+		lex.next()
+		switch tok {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		afterHash := prev == '#' && prefix
+		wasLabel := label
+		label = tok == scanner.Int && afterHash
+		prefix = tok == '-' || tok == '\'' ||
+			tok == '#' && !wasLabel || // but not the closing # of #n#
+			(tok == scanner.Ident || tok == scanner.Int) && afterHash ||
+			tok == '=' && wasLabel
+		prev = tok
+		if depth == 0 && !prefix {
+			return buf.Bytes(), nil
+		}
+	}
+}
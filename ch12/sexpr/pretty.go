@@ -10,30 +10,89 @@ import (
 // 1979 Stanford technical report, "Pretty Printing".
 // http://i.stanford.edu/pub/cstr/reports/cs/tr/79/770/CS-TR-79-770.pdf
 
+// MarshalIndent is like Marshal but breaks lists that do not fit
+// within 80 columns across lines, aligning their elements.
 func MarshalIndent(v interface{}) ([]byte, error) {
-	p := printer{width: margin}
-	if err := pretty(&p, reflect.ValueOf(v)); err != nil {
+	return MarshalIndentOptions(v, IndentOptions{})
+}
+
+// IndentOptions control the layout of MarshalIndentOptions.
+type IndentOptions struct {
+	// Width is the number of columns within which lines should fit,
+	// if possible. The default is 80.
+	Width int
+
+	// Indent is the number of columns by which the elements of a list
+	// broken across lines are indented from its opening parenthesis.
+	// The default is 1, which aligns them after the parenthesis:
+	//	((Title "Dr. Strangelove")
+	//	 (Year 1964))
+	// An Indent of 2 gives the customary layout of hand-written Lisp:
+	//	(config
+	//	  (name "x"))
+	Indent int
+}
+
+// MarshalIndentOptions is like MarshalIndent but lays out lines as
+// directed by opts.
+func MarshalIndentOptions(v interface{}, opts IndentOptions) ([]byte, error) {
+	var buf bytes.Buffer
+	rv := reflect.ValueOf(v)
+	p, err := newPrinter(&buf, rv, opts)
+	if err != nil {
 		return nil, err
 	}
-	return p.Bytes(), nil
+	if err := pretty(p, rv); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
-const margin = 80
-
 type token struct {
-	kind rune // one of "s ()" (string, blank, start, end)
+	kind rune // one of "sc ()" (string, comment, blank, start, end)
 	str  string
 	size int
 }
 
+// infinity is the size of a token that cannot fit on any line.
+const infinity = 1<<31 - 1
+
 type printer struct {
 	tokens []*token // FIFO buffer
 	stack  []*token // stack of open ' ' and '(' tokens
 	rtotal int      // total number of spaces needed to print stream
+	ltotal int      // total number of spaces of the tokens printed
 
-	bytes.Buffer
+	writer
 	indents []int
 	width   int // remaining space
+	margin  int // width of a line
+	indent  int // indentation of the elements of a broken list
+
+	labels   *labels
+	unsorted bool // write map entries in iteration order
+}
+
+// newPrinter returns a printer that writes v to w as laid out by opts,
+// or an error if v cannot be encoded.
+func newPrinter(w writer, v reflect.Value, opts IndentOptions) (*printer, error) {
+	if opts.Width <= 0 {
+		opts.Width = 80
+	}
+	if opts.Indent <= 0 {
+		opts.Indent = 1
+	}
+	l, err := newLabels(v)
+	if err != nil {
+		return nil, err
+	}
+	return &printer{
+		writer: w,
+		width:  opts.Width,
+		margin: opts.Width,
+		indent: opts.Indent,
+		labels: l,
+	}, nil
 }
 
 func (p *printer) string(str string) {
@@ -43,8 +102,60 @@ func (p *printer) string(str string) {
 	} else {
 		p.tokens = append(p.tokens, tok)
 		p.rtotal += len(str)
+		p.check()
+	}
+}
+
+// comment prints a ; comment, which ends its line and so breaks the
+// lists that contain it. The comment follows the value before it on
+// the same line: the blank between them has size 0, so it never
+// breaks, unless that value is itself a comment.
+func (p *printer) comment(text string) {
+	tok := &token{kind: 'c', str: ";" + text, size: p.margin}
+	if len(p.stack) == 0 {
+		p.print(tok)
+	} else {
+		if last := len(p.stack) - 1; p.stack[last].kind == ' ' {
+			p.stack[last].size = 0
+			p.stack = p.stack[:last] // pop
+		}
+		p.tokens = append(p.tokens, tok)
+		p.rtotal += p.margin
+		p.check()
 	}
 }
+
+// check prints the tokens at the front of the buffer once the text
+// that follows them is too wide for the rest of the line: a blank
+// among them must then break the line, whatever the size of its list.
+// So the buffer holds little more than a line of text, and a long
+// list is written as it is produced.
+func (p *printer) check() {
+	for len(p.tokens) > 0 && p.rtotal-p.ltotal > p.width {
+		if t := p.tokens[0]; t.size < 0 { // the bottom of the stack
+			t.size = infinity
+			p.stack = p.stack[1:]
+		}
+		p.advance()
+	}
+}
+
+// advance prints the tokens at the front of the buffer whose sizes are
+// known.
+func (p *printer) advance() {
+	for len(p.tokens) > 0 && p.tokens[0].size >= 0 {
+		t := p.tokens[0]
+		p.tokens = p.tokens[1:]
+		p.print(t)
+		switch t.kind {
+		case 's', 'c':
+			p.ltotal += t.size
+		case ' ':
+			p.ltotal++
+		}
+	}
+}
+
 func (p *printer) pop() (top *token) {
 	last := len(p.stack) - 1
 	top, p.stack = p.stack[last], p.stack[:last]
@@ -52,7 +163,7 @@ func (p *printer) pop() (top *token) {
 }
 func (p *printer) begin() {
 	if len(p.stack) == 0 {
-		p.rtotal = 1
+		p.rtotal, p.ltotal = 1, 1
 	}
 	t := &token{kind: '(', size: -p.rtotal}
 	p.tokens = append(p.tokens, t)
@@ -62,23 +173,22 @@ func (p *printer) begin() {
 func (p *printer) end() {
 	p.string(")")
 	p.tokens = append(p.tokens, &token{kind: ')'})
-	x := p.pop()
-	x.size += p.rtotal
-	if x.kind == ' ' {
-		p.pop().size += p.rtotal
+	// The tokens of this list are gone from the stack if check
+	// has printed them.
+	if len(p.stack) > 0 {
+		x := p.pop()
+		x.size += p.rtotal
+		if x.kind == ' ' && len(p.stack) > 0 {
+			p.pop().size += p.rtotal
+		}
 	}
 	if len(p.stack) == 0 {
-		for _, tok := range p.tokens {
-			p.print(tok)
-		}
-		p.tokens = nil
+		p.advance()
 	}
 }
 func (p *printer) space() {
-	last := len(p.stack) - 1
-	x := p.stack[last]
-	if x.kind == ' ' {
-		x.size += p.rtotal
+	if last := len(p.stack) - 1; last >= 0 && p.stack[last].kind == ' ' {
+		p.stack[last].size += p.rtotal
 		p.stack = p.stack[:last] // pop
 	}
 	t := &token{kind: ' ', size: -p.rtotal}
@@ -91,14 +201,17 @@ func (p *printer) print(t *token) {
 	case 's':
 		p.WriteString(t.str)
 		p.width -= len(t.str)
+	case 'c':
+		p.WriteString(t.str)
+		p.width = -1 // break at the next blank
 	case '(':
 		p.indents = append(p.indents, p.width)
 	case ')':
 		p.indents = p.indents[:len(p.indents)-1] // pop
 	case ' ':
 		if t.size > p.width {
-			p.width = p.indents[len(p.indents)-1] - 1
-			fmt.Fprintf(&p.Buffer, "\n%*s", margin-p.width, "")
+			p.width = p.indents[len(p.indents)-1] - p.indent
+			fmt.Fprintf(p.writer, "\n%*s", p.margin-p.width, "")
 		} else {
 			p.WriteByte(' ')
 			p.width--
@@ -110,6 +223,13 @@ func (p *printer) stringf(format string, args ...interface{}) {
 }
 
 func pretty(p *printer, v reflect.Value) error {
+	if data, ok, err := marshal(v); ok {
+		if err != nil {
+			return err
+		}
+		p.string(string(data))
+		return nil
+	}
 	switch v.Kind() {
 	case reflect.Invalid:
 		p.string("nil")
@@ -122,7 +242,39 @@ func pretty(p *printer, v reflect.Value) error {
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
 		p.stringf("%d", v.Uint())
 
+	case reflect.Bool:
+		if v.Bool() {
+			p.string("t")
+		} else {
+			p.string("nil")
+		}
+
+	case reflect.Float32, reflect.Float64:
+		s, err := formatFloat(v.Float(), v.Type().Bits())
+		if v.Type() == floatValueType {
+			s, err = formatFloatValue(Float(v.Float()))
+		}
+		if err != nil {
+			return err
+		}
+		p.string(s)
+
+	case reflect.Complex64, reflect.Complex128:
+		s, err := formatComplex(v.Complex(), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		p.string(s)
+
 	case reflect.String:
+		if v.Type() == symbolType {
+			p.string(v.String())
+			break
+		}
+		if v.Type() == commentType {
+			p.comment(v.String())
+			break
+		}
 		p.stringf("%q", v.String())
 
 	case reflect.Array, reflect.Slice: // (value ...)
@@ -135,18 +287,31 @@ func pretty(p *printer, v reflect.Value) error {
 				return err
 			}
 		}
+		if n := v.Len(); n > 0 && isComment(v.Index(n-1)) {
+			p.space() // end the comment's line before the ')'
+		}
 		p.end()
 
 	case reflect.Struct: // ((name value ...)
+		if v.Type() == macroType {
+			p.string(v.Field(0).String())
+			return pretty(p, v.Field(1))
+		}
 		p.begin()
-		for i := 0; i < v.NumField(); i++ {
-			if i > 0 {
+		sep := false
+		for _, f := range fields(v.Type()) {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			if sep {
 				p.space()
 			}
+			sep = true
 			p.begin()
-			p.string(v.Type().Field(i).Name)
+			p.string(f.name)
 			p.space()
-			if err := pretty(p, v.Field(i)); err != nil {
+			if err := pretty(p, fv); err != nil {
 				return err
 			}
 			p.end()
@@ -154,17 +319,21 @@ func pretty(p *printer, v reflect.Value) error {
 		p.end()
 
 	case reflect.Map: // ((key value ...)
+		keys, err := mapKeys(v, !p.unsorted)
+		if err != nil {
+			return err
+		}
 		p.begin()
-		for i, key := range v.MapKeys() {
+		for i, key := range keys {
 			if i > 0 {
 				p.space()
 			}
 			p.begin()
-			if err := pretty(p, key); err != nil {
+			if err := pretty(p, key.v); err != nil {
 				return err
 			}
 			p.space()
-			if err := pretty(p, v.MapIndex(key)); err != nil {
+			if err := pretty(p, v.MapIndex(key.v)); err != nil {
 				return err
 			}
 			p.end()
@@ -172,10 +341,44 @@ func pretty(p *printer, v reflect.Value) error {
 		p.end()
 
 	case reflect.Ptr:
+		if v.IsNil() {
+			p.string("nil")
+			break
+		}
+		if n, written := p.labels.label(v); written {
+			p.stringf("#%d#", n)
+			break
+		} else if n > 0 {
+			p.stringf("#%d=", n)
+		}
 		return pretty(p, v.Elem())
 
-	default: // float, complex, bool, chan, func, interface
+	case reflect.Interface: // ("type" value)
+		if v.IsNil() {
+			p.string("nil")
+			break
+		}
+		if v.Type() == valueType {
+			return pretty(p, v.Elem())
+		}
+		p.begin()
+		p.stringf("%q", v.Elem().Type())
+		p.space()
+		if err := pretty(p, v.Elem()); err != nil {
+			return err
+		}
+		p.end()
+
+	default: // chan, func, unsafe pointer
 		return fmt.Errorf("unsupported type: %s", v.Type())
 	}
 	return nil
 }
+
+// isComment reports whether v holds a Comment.
+func isComment(v reflect.Value) bool {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v.Type() == commentType
+}
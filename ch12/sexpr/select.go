@@ -0,0 +1,233 @@
+package sexpr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// A Match is a value selected from a tree by Select, and its path from
+// the root of the tree, such as Actor["Dr. Strangelove"] or Oscars[2].
+type Match struct {
+	Path  string
+	Value Value
+}
+
+// String returns the path and the value of the match as an
+// S-expression, separated by a colon.
+func (m Match) String() string {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	if err := writeTree(w, m.Value); err != nil {
+		fmt.Fprintf(w, "%v", m.Value)
+	}
+	w.Flush()
+	if m.Path == "" {
+		return buf.String()
+	}
+	return m.Path + ": " + buf.String()
+}
+
+// A step is one step of a query.
+type step struct {
+	op    rune  // '*' for any child, '/' for any descendant, or 0
+	index int   // index of the list element, if key is nil
+	key   Value // Symbol or String key of the pair, if op is 0
+}
+
+// Select returns the values of the tree doc that match the query, in
+// the order in which they appear.
+//
+// A query is a sequence of steps from the root of doc, each of which
+// selects children of the values selected by the previous steps:
+//
+//	Name       the value of the pair (Name value), ignoring case
+//	"key"      the value of the pair ("key" value)
+//	[n] or n   element n of a list, counting from 0
+//	*          every child: the value of each pair, if the list
+//	           holds pairs as a struct or map does, else each element
+//	**         the value itself and all its descendants
+//
+// Steps are separated by spaces or dots, and parentheses are ignored,
+// so (Actor *), Actor.*, and Actor * are the same query. The datum
+// label #n= of a value and comments in lists are transparent to
+// queries, and names may contain dashes, as in Lisp syntax.
+func Select(doc Value, query string) ([]Match, error) {
+	steps, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return selectTree(steps, "", doc, nil), nil
+}
+
+func parseQuery(query string) ([]step, error) {
+	var scan scanner.Scanner
+	scan.Init(strings.NewReader(query))
+	scan.Mode = scanner.GoTokens
+	scan.IsIdentRune = func(ch rune, i int) bool {
+		return isLispIdentRune(ch, i) && ch != '*' && ch != '.' // Actor.*
+	}
+	var err error
+	scan.Error = func(s *scanner.Scanner, msg string) {
+		if err == nil {
+			err = fmt.Errorf("sexpr: bad query %q: %s", query, msg)
+		}
+	}
+	bad := func(format string, args ...interface{}) error {
+		return fmt.Errorf("sexpr: bad query %q: %s", query, fmt.Sprintf(format, args...))
+	}
+	var steps []step
+	for tok := scan.Scan(); tok != scanner.EOF; tok = scan.Scan() {
+		if err != nil {
+			return nil, err
+		}
+		switch tok {
+		case '(', ')', '.':
+			continue
+		case scanner.Ident:
+			steps = append(steps, step{key: Symbol(scan.TokenText())})
+		case scanner.String:
+			s, _ := strconv.Unquote(scan.TokenText())
+			steps = append(steps, step{key: String(s)})
+		case scanner.Int:
+			i, err := strconv.Atoi(scan.TokenText())
+			if err != nil {
+				return nil, bad("bad index %s", scan.TokenText())
+			}
+			steps = append(steps, step{index: i})
+		case scanner.Float:
+			// The scanner reads Oscars.2 as Oscars and .2, and
+			// 1.2 as one token: each is a run of index steps.
+			text := scan.TokenText()
+			if strings.Trim(text, "0123456789.") != "" {
+				return nil, bad("bad index %s", text)
+			}
+			for _, f := range strings.FieldsFunc(text, func(r rune) bool { return r == '.' }) {
+				i, err := strconv.Atoi(f)
+				if err != nil {
+					return nil, bad("bad index %s", f)
+				}
+				steps = append(steps, step{index: i})
+			}
+		case '[':
+			if scan.Scan() != scanner.Int {
+				return nil, bad("got %s after [, want index", scan.TokenText())
+			}
+			i, err := strconv.Atoi(scan.TokenText())
+			if err != nil {
+				return nil, bad("bad index %s", scan.TokenText())
+			}
+			if scan.Scan() != ']' {
+				return nil, bad("got %s after [%d, want ]", scan.TokenText(), i)
+			}
+			steps = append(steps, step{index: i})
+		case '*':
+			if scan.Peek() == '*' { // **
+				scan.Next()
+				steps = append(steps, step{op: '/'})
+			} else {
+				steps = append(steps, step{op: '*'})
+			}
+		default:
+			return nil, bad("unexpected %s", scan.TokenText())
+		}
+	}
+	return steps, err
+}
+
+// selectTree appends to matches the values of tree, whose path is
+// path, that match steps.
+func selectTree(steps []step, path string, tree Value, matches []Match) []Match {
+	tree = unlabel(tree)
+	if len(steps) == 0 {
+		return append(matches, Match{path, tree})
+	}
+	s, rest := steps[0], steps[1:]
+	if s.op == '/' {
+		matches = selectTree(rest, path, tree, matches)
+		rest = steps // continue below with each child
+	}
+	list, ok := tree.(List)
+	if !ok {
+		return matches
+	}
+	list = uncommented(list)
+	if s.op == 0 && s.key == nil {
+		if s.index < len(list) {
+			matches = selectTree(rest, fmt.Sprintf("%s[%d]", path, s.index), list[s.index], matches)
+		}
+		return matches
+	}
+	pairs := isPairs(list)
+	for i, item := range list {
+		if !pairs {
+			if s.op != 0 {
+				matches = selectTree(rest, fmt.Sprintf("%s[%d]", path, i), item, matches)
+			}
+			continue
+		}
+		pair := item.(List)
+		if s.op != 0 || keyMatches(s.key, pair[0]) {
+			matches = selectTree(rest, pairPath(path, pair[0]), pair[1], matches)
+		}
+	}
+	return matches
+}
+
+// isPairs reports whether list is a non-empty list of pairs whose
+// first elements are atoms, as in the encoding of a struct or map.
+func isPairs(list List) bool {
+	for _, item := range list {
+		pair, ok := item.(List)
+		if !ok || len(pair) != 2 {
+			return false
+		}
+		switch pair[0].(type) {
+		case Symbol, String, Int, Float:
+		default:
+			return false
+		}
+	}
+	return len(list) > 0
+}
+
+// keyMatches reports whether the key of a pair matches the key of a
+// query step. A symbol in the query matches a field name regardless
+// of case, as Unmarshal does, or a string key exactly.
+func keyMatches(want, key Value) bool {
+	switch want := want.(type) {
+	case Symbol:
+		switch key := key.(type) {
+		case Symbol:
+			return strings.EqualFold(string(want), string(key))
+		case String:
+			return string(want) == string(key)
+		}
+	case String:
+		switch key := key.(type) {
+		case Symbol:
+			return string(want) == string(key)
+		case String:
+			return want == key
+		}
+	}
+	return false
+}
+
+// pairPath returns the path of the value of the pair with the given key
+// in the list whose path is path.
+func pairPath(path string, key Value) string {
+	switch key := key.(type) {
+	case Symbol:
+		if path == "" {
+			return string(key)
+		}
+		return path + "." + string(key)
+	case String:
+		return fmt.Sprintf("%s[%q]", path, string(key))
+	}
+	return fmt.Sprintf("%s[%v]", path, key)
+}
@@ -0,0 +1,85 @@
+package sexpr
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const movie = `((Title "Dr. Strangelove") (Year 1964)
+ (Actor (("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott")))
+ (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)" "Best Director (Nomin.)"))
+ (Sequel #1=((Title "Dr. Strangelove II") (Prequel #1#))))`
+
+func TestSelect(t *testing.T) {
+	var doc Value
+	if err := Unmarshal([]byte(movie), &doc); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		query string
+		want  []string
+	}{
+		{"Year", []string{`Year: 1964`}},
+		{"(year)", []string{`Year: 1964`}},
+		{"Oscars[2]", []string{`Oscars[2]: "Best Director (Nomin.)"`}},
+		{"Oscars.2", []string{`Oscars[2]: "Best Director (Nomin.)"`}},
+		{"Actor.1.0", []string{`Actor[1][0]: "Gen. Buck Turgidson"`}},
+		{"Oscars 5", nil},
+		{"(Actor *)", []string{
+			`Actor["Dr. Strangelove"]: "Peter Sellers"`,
+			`Actor["Gen. Buck Turgidson"]: "George C. Scott"`,
+		}},
+		{`Actor."Dr. Strangelove"`, []string{`Actor["Dr. Strangelove"]: "Peter Sellers"`}},
+		{"Actor[1]", []string{`Actor[1]: ("Gen. Buck Turgidson" "George C. Scott")`}},
+		{"Sequel.Title", []string{`Sequel.Title: "Dr. Strangelove II"`}},
+		{"** Title", []string{
+			`Title: "Dr. Strangelove"`,
+			`Sequel.Title: "Dr. Strangelove II"`,
+		}},
+		{"Sequel **", []string{
+			`Sequel: ((Title "Dr. Strangelove II") (Prequel #1#))`,
+			`Sequel.Title: "Dr. Strangelove II"`,
+			`Sequel.Prequel: #1#`,
+		}},
+		{"Title *", nil},
+		{"", []string{movieText()}},
+	} {
+		matches, err := Select(doc, test.query)
+		if err != nil {
+			t.Errorf("Select(%q): %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.String())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Select(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+
+	for _, query := range []string{"Oscars[x]", "Oscars[1", "Oscars.2e1", "Actor -", `"unterminated`} {
+		if _, err := Select(doc, query); err == nil {
+			t.Errorf("Select(%q) succeeded, want error", query)
+		}
+	}
+}
+
+// movieText returns the movie as Match.String writes it.
+func movieText() string {
+	return strings.Join(strings.Fields(movie), " ")
+}
+
+func ExampleSelect() {
+	var doc Value
+	Unmarshal([]byte(`((Title "Dr. Strangelove") (Oscars ("Best Actor" "Best Picture")))`), &doc)
+	matches, _ := Select(doc, "Oscars *")
+	for _, m := range matches {
+		fmt.Println(m)
+	}
+	// Output:
+	// Oscars[0]: "Best Actor"
+	// Oscars[1]: "Best Picture"
+}
@@ -1,17 +1,24 @@
 package sexpr
 
 import (
+	"fmt"
+	"math"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"text/scanner"
+	"time"
+
+	"gopl.io/ch2/tempconv"
+	"gopl.io/ch4/github"
 )
 
 // Test verifies that encoding and decoding a complex data value
 // produces an equal result.
 //
-// The test does not make direct assertions about the encoded output
-// because the output depends on map iteration order, which is
-// nondeterministic.  The output of the t.Log statements can be
-// inspected by running the test with the -v flag:
+// The output of the t.Log statements can be inspected by running the
+// test with the -v flag; TestCanonical checks encoded output directly.
 //
 // 	$ go test -v gopl.io/ch12/sexpr
 //
@@ -70,28 +77,547 @@ func Test(t *testing.T) {
 	t.Logf("MarshalIndent() = \n%s\n", data)
 }
 
+func TestRoundTrip(t *testing.T) {
+	type Movie struct { // from gopl.io/ch4/movie
+		Title  string
+		Year   int
+		Color  bool
+		Actors []string
+	}
+	type Point struct {
+		X, Y   float64
+		Scale  float32
+		Phasor complex128
+		Small  complex64
+		Tag    interface{}
+	}
+	for _, test := range []struct {
+		v    interface{} // pointer to the value to encode
+		zero interface{} // pointer to a zero value to decode into
+		want string
+	}{
+		{&Movie{"Cool Hand Luke", 1967, true, []string{"Paul Newman"}}, new(Movie),
+			`((Title "Cool Hand Luke") (Year 1967) (Color t) (Actors ("Paul Newman")))`},
+		{&Movie{Title: "Casablanca", Year: 1942}, new(Movie),
+			`((Title "Casablanca") (Year 1942) (Color nil) (Actors ()))`},
+		{&Point{X: -1.5, Y: 1e21, Scale: 0.1, Phasor: 1 - 2i, Small: -0.5i}, new(Point),
+			`((X -1.5) (Y 1e+21) (Scale 0.1) (Phasor #C(1 -2)) (Small #C(0 -0.5)) (Tag nil))`},
+		{&Point{Tag: []int{1, 2, 3}}, new(Point),
+			`((X 0) (Y 0) (Scale 0) (Phasor #C(0 0)) (Small #C(0 0)) (Tag ("[]int" (1 2 3))))`},
+		{&Point{Tag: []interface{}{-7, "x", true}}, new(Point),
+			`((X 0) (Y 0) (Scale 0) (Phasor #C(0 0)) (Small #C(0 0)) ` +
+				`(Tag ("[]interface {}" (("int" -7) ("string" "x") ("bool" t)))))`},
+		{&[]uint8{0, 255}, new([]uint8), `(0 255)`},
+	} {
+		data, err := Marshal(test.v)
+		if err != nil {
+			t.Errorf("Marshal(%+v): %v", test.v, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", test.v, data, test.want)
+		}
+		if err := Unmarshal(data, test.zero); err != nil {
+			t.Errorf("Unmarshal(%s): %v", data, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.zero, test.v) {
+			t.Errorf("Unmarshal(%s) = %+v", data, test.zero)
+		}
+		if _, err := MarshalIndent(test.v); err != nil {
+			t.Errorf("MarshalIndent(%+v): %v", test.v, err)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	type Face struct{ Tag interface{} }
+	for _, v := range []interface{}{
+		math.NaN(),
+		math.Inf(-1),
+		complex(0, math.Inf(1)),
+		make(chan int),
+	} {
+		if data, err := Marshal(v); err == nil {
+			t.Errorf("Marshal(%v) = %s, want error", v, data)
+		}
+	}
+	var f Face
+	if err := Unmarshal([]byte(`((Tag ("chan int" nil)))`), &f); err == nil {
+		t.Errorf("Unmarshal of unregistered type succeeded: %+v", f)
+	}
+}
+
+func TestTags(t *testing.T) {
+	type Record struct {
+		ID      int      `sexpr:"id"`
+		Name    string   `sexpr:"name,omitempty" json:"title"`
+		Notes   []string `sexpr:",omitempty"`
+		Secret  string   `sexpr:"-"`
+		Rating  float64  `json:"rating,omitempty"`
+		Visible bool     `json:"-"`
+		hidden  int
+	}
+	for _, test := range []struct {
+		r    Record
+		want string
+	}{
+		{Record{ID: 1, Name: "a", Notes: []string{"b"}, Rating: 2.5},
+			`((id 1) (name "a") (Notes ("b")) (rating 2.5))`},
+		{Record{ID: 0, Secret: "s", Visible: true, hidden: 3},
+			`((id 0))`},
+	} {
+		data, err := Marshal(test.r)
+		if err != nil {
+			t.Errorf("Marshal(%+v): %v", test.r, err)
+			continue
+		}
+		if string(data) != test.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", test.r, data, test.want)
+		}
+		indented, err := MarshalIndent(test.r)
+		if err != nil || string(indented) != test.want {
+			t.Errorf("MarshalIndent(%+v) = %s, %v, want %s", test.r, indented, err, test.want)
+		}
+	}
+
+	// Decoding matches names without regard to case.
+	var r Record
+	data := `((ID 7) (NAME "x") (notes ("y" "z")) (Rating -1))`
+	if err := Unmarshal([]byte(data), &r); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	want := Record{ID: 7, Name: "x", Notes: []string{"y", "z"}, Rating: -1}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", data, r, want)
+	}
+	// Dropped and unexported fields are unknown: Unmarshal ignores
+	// them, and a Decoder may reject them.
+	for _, data := range []string{`((Secret "s"))`, `((hidden 1))`, `((Visible t))`} {
+		if err := Unmarshal([]byte(data), &r); err != nil {
+			t.Errorf("Unmarshal(%s): %v", data, err)
+		}
+		if !reflect.DeepEqual(r, want) {
+			t.Errorf("Unmarshal(%s) = %+v, want %+v", data, r, want)
+		}
+		dec := NewDecoder(strings.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&r); err == nil {
+			t.Errorf("Decode(%s) with DisallowUnknownFields succeeded, want error", data)
+		}
+	}
+
+	// json tags are honored, so structs written for encoding/json
+	// work unchanged.
+	issue := github.Issue{
+		Number:  1,
+		HTMLURL: "https://github.com/golang/go/issues/1",
+		Title:   "sexpr",
+		User:    &github.User{Login: "gopher", HTMLURL: "https://github.com/gopher"},
+	}
+	encoded, err := Marshal(issue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("Marshal() = %s", encoded)
+	var got github.Issue
+	if err := Unmarshal(encoded, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", encoded, err)
+	}
+	if !reflect.DeepEqual(got, issue) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", encoded, got, issue)
+	}
+}
+
+// celsius encodes a tempconv.Celcius as the string its String method
+// returns, such as "100°C".
+type celsius struct{ tempconv.Celcius }
+
+func (c celsius) MarshalSexpr() ([]byte, error) {
+	return []byte(fmt.Sprintf("%q", c.String())), nil
+}
+
+func (c *celsius) UnmarshalSexpr(data []byte) error {
+	var s string
+	if err := Unmarshal(data, &s); err != nil {
+		return err
+	}
+	_, err := fmt.Sscanf(s, "%g°C", (*float64)(&c.Celcius))
+	return err
+}
+
+// span encodes itself as a list (from to) rather than a struct.
+type span struct{ from, to int }
+
+func (s *span) MarshalSexpr() ([]byte, error) {
+	return []byte(fmt.Sprintf("(%d %d)", s.from, s.to)), nil
+}
+
+func (s *span) UnmarshalSexpr(data []byte) error {
+	var a [2]int
+	if err := Unmarshal(data, &a); err != nil {
+		return err
+	}
+	s.from, s.to = a[0], a[1]
+	return nil
+}
+
+func TestMarshaler(t *testing.T) {
+	type Reading struct {
+		Temp    celsius
+		Peak    *celsius
+		Range   *span
+		Lines   []span
+		When    time.Time
+		Elapsed time.Duration
+		Host    net.IP
+		Spare   net.IP
+		Phase   complex64
+	}
+	peak := celsius{-40.5}
+	r := Reading{
+		Temp:    celsius{100},
+		Peak:    &peak,
+		Range:   &span{-3, 4},
+		Lines:   []span{{1, 2}},
+		When:    time.Date(2015, 10, 26, 9, 30, 0, 500, time.UTC),
+		Elapsed: 90 * time.Minute,
+		Host:    net.ParseIP("192.168.0.1"),
+		Phase:   1i,
+	}
+	const want = `((Temp "100°C") (Peak "-40.5°C") (Range (-3 4)) (Lines ((1 2))) ` +
+		`(When "2015-10-26T09:30:00.0000005Z") (Elapsed "1h30m0s") ` +
+		`(Host "192.168.0.1") (Spare nil) (Phase #C(0 1)))`
+	data, err := Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("Marshal() = %s, want %s", data, want)
+	}
+	var got Reading
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	if !reflect.DeepEqual(got, r) {
+		t.Errorf("Unmarshal(%s) = %+v, want %+v", data, got, r)
+	}
+
+	for _, data := range []string{
+		`((Temp "hot"))`,
+		`((When "yesterday"))`,
+		`((Elapsed "forever"))`,
+		`((Host "192.168.0.256"))`,
+	} {
+		if err := Unmarshal([]byte(data), &got); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", data)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	type Index struct {
+		Words map[string][]int
+		Sizes map[int]bool
+		Tags  map[interface{}]string
+	}
+	x := Index{
+		Words: map[string][]int{"go": {1, 7}, "lisp": {3}, "c": nil, "Go": {2}},
+		// Keys are sorted by their encodings, so 10 comes before 9.
+		Sizes: map[int]bool{9: true, 10: false, -1: true, 0: true},
+		Tags:  map[interface{}]string{1: "int", "1": "string", 1.5: "float"},
+	}
+	const want = `((Words (("Go" (2)) ("c" ()) ("go" (1 7)) ("lisp" (3)))) ` +
+		`(Sizes ((-1 t) (0 t) (10 nil) (9 t))) ` +
+		`(Tags ((("float64" 1.5) "float") (("int" 1) "int") (("string" "1") "string"))))`
+	var first []byte
+	for i := 0; i < 10; i++ {
+		data, err := Marshal(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Fatalf("Marshal() = %s, want %s", data, want)
+		}
+		indented, err := MarshalIndent(x)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first == nil {
+			first = indented
+		} else if string(indented) != string(first) {
+			t.Fatalf("MarshalIndent() = %s, previously %s", indented, first)
+		}
+	}
+}
+
+// A target has a field of each kind the decoder supports.
+type target struct {
+	I8    int8
+	U     uint
+	F32   float32
+	C     complex128
+	B     bool
+	S     string
+	Arr   [2]int
+	Slice []string
+	Map   map[string]int
+	Ptr   *target
+	Any   interface{}
+	When  time.Time
+}
+
+func TestErrors(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		err   string // *SyntaxError or *UnmarshalTypeError
+		pos   string // line:column of the error
+	}{
+		{`((I8 127) (I8 128))`, "type", "1:15"},
+		{`((I8 -129))`, "type", "1:6"},
+		{`((U -1))`, "type", "1:5"},
+		{`((U 1.5))`, "type", "1:5"},
+		{`((F32 1e39))`, "type", "1:7"},
+		{`((I8 "x"))`, "type", "1:6"},
+		{`((S 1))`, "type", "1:5"},
+		{`((S t))`, "type", "1:5"},
+		{`((B #C(1 2)))`, "type", "1:5"},
+		{`((Arr (1 2 3)))`, "type", "1:12"},
+		{`((Map 5))`, "type", "1:7"},
+		{`((S (1)))`, "type", "1:6"},
+		{`((Any ("chan int" nil)))`, "type", "1:8"},
+		{`((Any ("no such type" 1)))`, "type", "1:8"},
+		{`((When "noon"))`, "", "1:8"},
+		{`((S "unterminated))`, "syntax", "1:5"},
+		{`((S "bad \q escape"))`, "syntax", "1:5"},
+		{`((I8 - x))`, "syntax", "1:8"},
+		{`((C #D(1 2)))`, "syntax", "1:6"},
+		{`((S foo))`, "syntax", "1:5"},
+		{`((1 2))`, "syntax", "1:3"},
+		{`((Slice ("a")`, "syntax", "1:14"},
+		{`((Any (1 2)))`, "syntax", "1:8"},
+		{`((Any ("int" 1 2)))`, "syntax", "1:16"},
+		{`((Any ("int")))`, "syntax", "1:13"},
+		{`((S "a")) extra`, "syntax", "1:11"},
+		{`((S 'a'))`, "syntax", "1:5"},
+		{``, "", ""},
+	} {
+		var x target
+		err := Unmarshal([]byte(test.input), &x)
+		if err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", test.input)
+			continue
+		}
+		var pos scanner.Position
+		switch err := err.(type) {
+		case *SyntaxError:
+			if test.err != "syntax" {
+				t.Errorf("Unmarshal(%s) = syntax error %v", test.input, err)
+			}
+			pos = err.Pos
+		case *UnmarshalTypeError:
+			if test.err != "type" {
+				t.Errorf("Unmarshal(%s) = type error %v", test.input, err)
+			}
+			pos = err.Pos
+		default:
+			if test.err != "" {
+				t.Errorf("Unmarshal(%s) = %T %v", test.input, err, err)
+			}
+			continue
+		}
+		if got := fmt.Sprintf("%d:%d", pos.Line, pos.Column); got != test.pos {
+			t.Errorf("Unmarshal(%s) = %v at %s, want %s", test.input, err, got, test.pos)
+		}
+	}
+
+	// Deep nesting is an error, not a stack overflow.
+	type R []R
+	deep := strings.Repeat("(", 1000000)
+	for _, v := range []interface{}{new(Value), new(interface{}), new(R)} {
+		if err := Unmarshal([]byte(deep), v); err == nil || !strings.Contains(err.Error(), "nested") {
+			t.Errorf("Unmarshal(%d open lists) into %T = %v, want nesting error", len(deep), v, err)
+		}
+	}
+	var r R
+	if err := Unmarshal([]byte(strings.Repeat("(", 100)+strings.Repeat(")", 100)), &r); err != nil {
+		t.Errorf("Unmarshal(100 nested lists): %v", err)
+	}
+
+	defer func() {
+		if r := recover(); r != "sexpr: Register of nil value" {
+			t.Errorf("Register(nil) panicked with %v", r)
+		}
+	}()
+	Register(nil)
+}
+
+// FuzzUnmarshal checks that no input makes Unmarshal panic, and that
+// whatever it decodes encodes again.
+//
+//	$ go test -fuzz=Unmarshal gopl.io/ch12/sexpr
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range []string{
+		`((I8 -3) (U 7) (F32 1.5) (C #C(1 -2)) (B t) (S "x\ty"))`,
+		`((Arr (1 2)) (Slice ("a" "b")) (Map (("k" 1))) (Ptr ((S "inner"))))`,
+		`((Any ("[]interface {}" (("int" 1) ("string" "s")))))`,
+		`((When "2015-10-26T09:30:00Z") (Unknown (1 (2 #C(3 4)))))`,
+		`((Ptr #1=((Ptr #1#))) (Any ("*int" #2=1)) (Unknown (#2# #3=(#3#))))`,
+		`((I8 128))`,
+		`(((`,
+		`#C`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var x target
+		if err := Unmarshal(data, &x); err != nil {
+			return
+		}
+		encoded, err := Marshal(x)
+		if err != nil {
+			t.Fatalf("Unmarshal(%q) = %+v, which Marshal cannot encode: %v", data, x, err)
+		}
+		var y target
+		if err := Unmarshal(encoded, &y); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", encoded, err)
+		}
+	})
+}
+
+// A labeledInt is shared by pointers in TestLabels. It is registered
+// here, once, as the type of an interface value.
+type labeledInt int
+
+func init() { Register((*labeledInt)(nil)) }
+
+func TestLabels(t *testing.T) {
+	// A cyclic linked list.
+	type List struct {
+		Value int
+		Next  *List
+	}
+	a := &List{Value: 1}
+	a.Next = &List{2, &List{3, a.Next}}
+	a.Next.Next.Next = a.Next
+	const wantList = `((Value 1) (Next #1=((Value 2) (Next ((Value 3) (Next #1#))))))`
+	data, err := Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != wantList {
+		t.Errorf("Marshal(list) = %s, want %s", data, wantList)
+	}
+	var l *List
+	if err := Unmarshal(data, &l); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	if l.Value != 1 || l.Next.Value != 2 || l.Next.Next.Value != 3 || l.Next.Next.Next != l.Next {
+		t.Errorf("Unmarshal(%s) did not rebuild the cycle", data)
+	}
+
+	// A binary tree with parent links, in the style of gopl.io/ch4/treesort.
+	type Tree struct {
+		Value               int
+		Left, Right, Parent *Tree
+	}
+	root := &Tree{Value: 2}
+	root.Left = &Tree{Value: 1, Parent: root}
+	root.Right = &Tree{Value: 3, Parent: root}
+	for _, marshal := range []func(interface{}) ([]byte, error){Marshal, MarshalIndent} {
+		data, err := marshal(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Logf("tree = %s", data)
+		var got *Tree
+		if err := Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal(%s): %v", data, err)
+		}
+		if got.Left.Parent != got || got.Right.Parent != got || got.Parent != nil ||
+			got.Left.Value != 1 || got.Right.Value != 3 {
+			t.Errorf("Unmarshal(%s) did not rebuild the tree", data)
+		}
+	}
+
+	// A DAG: two fields, an interface and a map share one pointer.
+	type DAG struct {
+		A, B *labeledInt
+		Any  interface{}
+		M    map[string]*labeledInt
+	}
+	n := labeledInt(42)
+	dag := DAG{A: &n, B: &n, Any: &n, M: map[string]*labeledInt{"x": &n}}
+	const wantDAG = `((A #1=42) (B #1#) (Any ("*sexpr.labeledInt" #1#)) (M (("x" #1#))))`
+	data, err = Marshal(dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != wantDAG {
+		t.Errorf("Marshal(dag) = %s, want %s", data, wantDAG)
+	}
+	var d DAG
+	if err := Unmarshal(data, &d); err != nil {
+		t.Fatalf("Unmarshal(%s): %v", data, err)
+	}
+	if *d.A != 42 || d.B != d.A || d.Any.(*labeledInt) != d.A || d.M["x"] != d.A {
+		t.Errorf("Unmarshal(%s) did not rebuild the sharing", data)
+	}
+
+	for _, data := range []string{
+		`((A #1#))`,            // undefined
+		`((A #1=1) (M #1#))`,   // wrong type
+		`((A #1?1))`,           // bad macro
+		`((Any ("int" #1=1)))`, // only pointers are labeled
+	} {
+		var d DAG
+		if err := Unmarshal([]byte(data), &d); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", data)
+		}
+	}
+
+	// A cycle without a pointer cannot be labeled.
+	m := map[string]interface{}{"a": 1}
+	m["self"] = m
+	s := []interface{}{1, nil}
+	s[1] = s
+	for _, v := range []interface{}{m, s, DAG{Any: s}} {
+		if data, err := Marshal(v); err == nil {
+			t.Errorf("Marshal(cycle) = %s, want error", data)
+		}
+		if data, err := MarshalIndent(v); err == nil {
+			t.Errorf("MarshalIndent(cycle) = %s, want error", data)
+		}
+	}
+	// But the same slice may appear twice without a cycle.
+	twice := []interface{}{1}
+	const wantTwice = `(("[]interface {}" (("int" 1))) ("[]interface {}" (("int" 1))))`
+	if data, err := Marshal([]interface{}{twice, twice}); err != nil || string(data) != wantTwice {
+		t.Errorf("Marshal(twice) = %s, %v, want %s", data, err, wantTwice)
+	}
+}
+
 /*
 Output:
 
-$ go test -v gopl.io/ch12/sexpr
+$ go test -v -run='^Test$' gopl.io/ch12/sexpr
 
 === RUN   Test
-    sexpr_test.go:48: Marshal() = ((Title "Dr. Strangelove") (Subtitle "How I Learned to Stop Worrying and Love the Bomb") (Year 1964) (Actor (("Maj. T.J. \"King\" Kong" "Slim Pickens") ("Dr. Strangelove" "Peter Sellers") ("Grp. Capt. Lionel Mandrake" "Peter Sellers") ("Pres. Merkin Muffley" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott") ("Brig. Gen. Jack D. Ripper" "Sterling Hayden"))) (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)" "Best Director (Nomin.)" "Best Picture (Nomin.)")) (Sequel nil))
-    sexpr_test.go:55: Unmarshal() = {Title:Dr. Strangelove Subtitle:How I Learned to Stop Worrying and Love the Bomb Year:1964 Actor:map[Brig. Gen. Jack D. Ripper:Sterling Hayden Dr. Strangelove:Peter Sellers Gen. Buck Turgidson:George C. Scott Grp. Capt. Lionel Mandrake:Peter Sellers Maj. T.J. "King" Kong:Slim Pickens Pres. Merkin Muffley:Peter Sellers] Oscars:[Best Actor (Nomin.) Best Adapted Screenplay (Nomin.) Best Director (Nomin.) Best Picture (Nomin.)] Sequel:<nil>}
-    sexpr_test.go:62: MarshalIndent() =
+    sexpr_test.go:55: Marshal() = ((Title "Dr. Strangelove") (Subtitle "How I Learned to Stop Worrying and Love the Bomb") (Year 1964) (Actor (("Brig. Gen. Jack D. Ripper" "Sterling Hayden") ("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott") ("Grp. Capt. Lionel Mandrake" "Peter Sellers") ("Maj. T.J. \"King\" Kong" "Slim Pickens") ("Pres. Merkin Muffley" "Peter Sellers"))) (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)" "Best Director (Nomin.)" "Best Picture (Nomin.)")) (Sequel nil))
+    sexpr_test.go:62: Unmarshal() = {Title:Dr. Strangelove Subtitle:How I Learned to Stop Worrying and Love the Bomb Year:1964 Actor:map[Brig. Gen. Jack D. Ripper:Sterling Hayden Dr. Strangelove:Peter Sellers Gen. Buck Turgidson:George C. Scott Grp. Capt. Lionel Mandrake:Peter Sellers Maj. T.J. "King" Kong:Slim Pickens Pres. Merkin Muffley:Peter Sellers] Oscars:[Best Actor (Nomin.) Best Adapted Screenplay (Nomin.) Best Director (Nomin.) Best Picture (Nomin.)] Sequel:<nil>}
+    sexpr_test.go:74: MarshalIndent() =
         ((Title "Dr. Strangelove")
          (Subtitle "How I Learned to Stop Worrying and Love the Bomb") (Year 1964)
          (Actor
-          (("Gen. Buck Turgidson" "George C. Scott")
-           ("Brig. Gen. Jack D. Ripper" "Sterling Hayden")
-           ("Maj. T.J. \"King\" Kong" "Slim Pickens")
-           ("Dr. Strangelove" "Peter Sellers")
+          (("Brig. Gen. Jack D. Ripper" "Sterling Hayden")
+           ("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott")
            ("Grp. Capt. Lionel Mandrake" "Peter Sellers")
+           ("Maj. T.J. \"King\" Kong" "Slim Pickens")
            ("Pres. Merkin Muffley" "Peter Sellers")))
          (Oscars
           ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)"
            "Best Director (Nomin.)" "Best Picture (Nomin.)")) (Sequel nil))
 --- PASS: Test (0.00s)
 PASS
-ok      gopl.io/ch12/sexpr      0.003s
+ok      gopl.io/ch12/sexpr      0.004s
 */
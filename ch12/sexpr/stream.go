@@ -0,0 +1,259 @@
+package sexpr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"text/scanner"
+)
+
+// A Decoder reads and decodes S-expressions from an input stream.
+type Decoder struct {
+	lex                   *lexer
+	primed                bool                     // lex.token holds the next unconsumed token
+	labels                map[string]reflect.Value // pointers labeled by #n= in the current value
+	disallowUnknownFields bool
+}
+
+// NewDecoder returns a new decoder that reads from r. The decoder
+// reads r a buffer at a time, so the stream may be arbitrarily long.
+func NewDecoder(r io.Reader) *Decoder {
+	lex := &lexer{scan: scanner.Scanner{Mode: scanner.GoTokens}}
+	lex.scan.Init(r)
+	lex.scan.Error = func(s *scanner.Scanner, msg string) {
+		if lex.err == nil {
+			pos := s.Position
+			if !pos.IsValid() {
+				pos = s.Pos()
+			}
+			lex.err = &SyntaxError{pos, msg}
+		}
+	}
+	return &Decoder{lex: lex}
+}
+
+// UseLispSyntax causes the Decoder to read the input as Lisp rather
+// than Go tokens, so that it accepts ; comments to the end of the line,
+// symbols such as max-results that contain dashes, and quoted values
+// 'x. It must be called before the first call to Decode or Token.
+//
+// Decoding into a Value keeps the comments within lists as Comments;
+// other decoding discards them.
+func (dec *Decoder) UseLispSyntax() {
+	dec.lex.lisp = true
+	dec.lex.scan.Mode &^= scanner.ScanChars // ' begins a quote
+	dec.lex.scan.IsIdentRune = isLispIdentRune
+}
+
+// DisallowUnknownFields causes the Decoder to return an error when a
+// struct in the input has a field that the destination struct lacks.
+func (dec *Decoder) DisallowUnknownFields() { dec.disallowUnknownFields = true }
+
+// peek returns the next unconsumed token of the lexer.
+func (dec *Decoder) peek() rune {
+	if !dec.primed {
+		dec.lex.next()
+		dec.primed = true
+	}
+	if dec.lex.token == unread {
+		dec.lex.next()
+	}
+	return dec.lex.token
+}
+
+// Decode reads the next S-expression from its input and stores it in
+// the variable whose address is in the non-nil pointer out. At the end
+// of the input, it returns io.EOF. Decode reads no further than the
+// closing parenthesis of a list, so it does not wait on a stream for
+// the value after it.
+//
+// If out is a *interface{} or a *Value, Decode stores a Value, so that
+// input of any shape may be read and inspected.
+func (dec *Decoder) Decode(out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("sexpr: Decode(non-pointer or nil %T)", out)
+	}
+	if dec.peek() == scanner.EOF {
+		if dec.lex.err != nil {
+			return dec.lex.err
+		}
+		return io.EOF
+	}
+	if p, ok := out.(*interface{}); ok {
+		var tree Value
+		if err := dec.read(reflect.ValueOf(&tree).Elem()); err != nil {
+			return err
+		}
+		*p = tree
+		return nil
+	}
+	dec.labels = make(map[string]reflect.Value)
+	return dec.read(v.Elem())
+}
+
+// More reports whether there is another element in the current list,
+// or, outside any list, another value in the input.
+func (dec *Decoder) More() bool {
+	tok := dec.peek()
+	return dec.lex.err == nil && tok != ')' && tok != scanner.EOF
+}
+
+// A Token is one of StartList, EndList, Symbol, String, Int, Float or,
+// in Lisp syntax, Comment.
+type Token interface{}
+
+// A StartList is the opening parenthesis of a list.
+type StartList struct{}
+
+// An EndList is the closing parenthesis of a list.
+type EndList struct{}
+
+// A Symbol is an unquoted identifier such as a field name, t or nil.
+// The reader macro of a complex number #C(1 2) is the Symbol "#C"; the
+// datum labels #1= and #1#, and the quote ' of 'x, are Symbols too.
+type Symbol string
+
+// A String is a quoted string literal.
+type String string
+
+// An Int is an integer literal.
+type Int int64
+
+// A Float is a floating-point literal.
+type Float float64
+
+// A Comment is the text of a ; comment in Lisp syntax, after the
+// semicolon and up to the end of the line.
+type Comment string
+
+// Token returns the next token in the input stream. At the end of the
+// input, it returns nil, io.EOF.
+//
+// A Decoder's tokens may be read with both Token and Decode; Decode
+// consumes all the tokens of the value it reads.
+func (dec *Decoder) Token() (Token, error) {
+	lex := dec.lex
+	tok := dec.peek()
+	if lex.err != nil {
+		return nil, lex.err
+	}
+	if len(lex.comments) > 0 {
+		text := lex.comments[0]
+		lex.comments = lex.comments[1:]
+		return Comment(text), nil
+	}
+	text := lex.text()
+	pos := lex.scan.Position
+	dec.primed = false
+	switch tok {
+	case scanner.EOF:
+		dec.primed = true // stay at the end
+		return nil, io.EOF
+	case '(':
+		return StartList{}, nil
+	case ')':
+		return EndList{}, nil
+	case '\'':
+		return Symbol("'"), nil
+	case scanner.Ident:
+		return Symbol(text), nil
+	case scanner.String:
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, &SyntaxError{pos, "malformed string " + text}
+		}
+		return String(s), nil
+	case scanner.Int, scanner.Float:
+		return number(text, pos)
+	case '-':
+		if t := dec.peek(); t == scanner.Int || t == scanner.Float {
+			dec.primed = false
+			return number("-"+lex.text(), pos)
+		}
+	case '#':
+		switch dec.peek() {
+		case scanner.Ident: // #C
+			dec.primed = false
+			return Symbol("#" + lex.text()), nil
+		case scanner.Int: // #n= or #n#
+			n := lex.text()
+			dec.primed = false
+			if t := dec.peek(); t == '=' || t == '#' {
+				dec.primed = false
+				return Symbol("#" + n + string(t)), nil
+			}
+		}
+	}
+	return nil, &SyntaxError{pos, "unexpected " + strconv.Quote(text)}
+}
+
+// number returns the Int or Float token of the literal text.
+func number(text string, pos scanner.Position) (Token, error) {
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return Int(i), nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return nil, &SyntaxError{pos, "malformed number " + text}
+	}
+	return Float(f), nil
+}
+
+// An Encoder writes S-expressions to an output stream.
+type Encoder struct {
+	w        *bufio.Writer
+	indent   *IndentOptions // layout of MarshalIndentOptions, or nil for Marshal's
+	unsorted bool           // see SetCanonical
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// SetIndent causes the Encoder to lay out each value as
+// MarshalIndentOptions does with opts, rather than on one line as
+// Marshal does.
+func (enc *Encoder) SetIndent(opts IndentOptions) { enc.indent = &opts }
+
+// SetCanonical controls whether the Encoder writes canonical output, as
+// Marshal does, which it does by default. With canonical false, the
+// entries of a map are written in Go's iteration order, which varies
+// from one encoding to the next, saving the time and memory of
+// encoding and sorting the keys of each map before its entries.
+func (enc *Encoder) SetCanonical(canonical bool) { enc.unsorted = !canonical }
+
+// Encode writes the S-expression encoding of v to the stream, followed
+// by a newline, so that a Decoder may read a sequence of values back.
+//
+// Unlike Marshal, Encode writes the encoding as it produces it, a
+// buffer at a time, so that the elements of a long slice or map are
+// not all held in memory at once. (The pretty printer of SetIndent
+// holds at most about a line of text.) If v cannot be encoded, the
+// stream holds the part of the encoding written before the error.
+func (enc *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	var err error
+	if enc.indent != nil {
+		var p *printer
+		if p, err = newPrinter(enc.w, rv, *enc.indent); err == nil {
+			p.unsorted = enc.unsorted
+			err = pretty(p, rv)
+		}
+	} else {
+		var l *labels
+		if l, err = newLabels(rv); err == nil {
+			err = encode(enc.w, rv, &encodeState{l, enc.unsorted})
+		}
+	}
+	if err == nil {
+		err = enc.w.WriteByte('\n')
+	}
+	if ferr := enc.w.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
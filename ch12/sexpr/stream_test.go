@@ -0,0 +1,298 @@
+package sexpr_test
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopl.io/ch12/sexpr"
+)
+
+func TestDecoder(t *testing.T) {
+	type Entry struct {
+		Level string
+		Code  int
+	}
+	const log = `((Level "info") (Code 0))
+((Level "warn") (Code 1))
+((Level "error") (Code -2))`
+	dec := sexpr.NewDecoder(strings.NewReader(log))
+	var got []Entry
+	for {
+		var e Entry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, e)
+	}
+	want := []Entry{{"info", 0}, {"warn", 1}, {"error", -2}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %v, want %v", got, want)
+	}
+}
+
+// A Decoder returns each value as soon as its closing parenthesis
+// arrives, so that values may be exchanged in turn over a pipe.
+func TestDecoderPipe(t *testing.T) {
+	type Entry struct {
+		Level string
+		Code  int
+	}
+	r, w := io.Pipe()
+	defer r.Close()
+	ack := make(chan bool)
+	go func() {
+		enc := sexpr.NewEncoder(w)
+		for i := 0; i < 3; i++ {
+			if enc.Encode(Entry{"info", i}) != nil || !<-ack {
+				break
+			}
+		}
+		w.Close()
+	}()
+	dec := sexpr.NewDecoder(r)
+	for i := 0; i < 3; i++ {
+		done := make(chan error)
+		var e Entry
+		go func() { done <- dec.Decode(&e) }()
+		select {
+		case err := <-done:
+			if err != nil || e.Code != i {
+				t.Fatalf("Decode = %v, %v, want code %d", e, err, i)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Decode of value %d is waiting for the next value", i)
+		}
+		ack <- true
+	}
+	var e Entry
+	if err := dec.Decode(&e); err != io.EOF {
+		t.Errorf("Decode at end = %v, want EOF", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	const input = `((Name "x\ty") (N -3) (F 1.5) (B t) (C #C(0 -1)) (L ()))`
+	want := []sexpr.Token{
+		sexpr.StartList{},
+		sexpr.StartList{}, sexpr.Symbol("Name"), sexpr.String("x\ty"), sexpr.EndList{},
+		sexpr.StartList{}, sexpr.Symbol("N"), sexpr.Int(-3), sexpr.EndList{},
+		sexpr.StartList{}, sexpr.Symbol("F"), sexpr.Float(1.5), sexpr.EndList{},
+		sexpr.StartList{}, sexpr.Symbol("B"), sexpr.Symbol("t"), sexpr.EndList{},
+		sexpr.StartList{}, sexpr.Symbol("C"), sexpr.Symbol("#C"),
+		sexpr.StartList{}, sexpr.Int(0), sexpr.Int(-1), sexpr.EndList{}, sexpr.EndList{},
+		sexpr.StartList{}, sexpr.Symbol("L"), sexpr.StartList{}, sexpr.EndList{}, sexpr.EndList{},
+		sexpr.EndList{},
+	}
+	dec := sexpr.NewDecoder(strings.NewReader(input))
+	var got []sexpr.Token
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Token:\ngot  %v\nwant %v", got, want)
+	}
+
+	for _, input := range []string{"- x", "#3", "."} {
+		dec := sexpr.NewDecoder(strings.NewReader(input))
+		if tok, err := dec.Token(); err == nil {
+			t.Errorf("Token(%q) = %v, want error", input, tok)
+		}
+	}
+}
+
+// Tokens and values may be read from the same stream: here Token
+// skips into a list, and Decode reads each of its elements.
+func TestTokenDecode(t *testing.T) {
+	dec := sexpr.NewDecoder(strings.NewReader(`(batch (1 2) (3) ())`))
+	for _, want := range []sexpr.Token{sexpr.StartList{}, sexpr.Symbol("batch")} {
+		if tok, err := dec.Token(); err != nil || tok != want {
+			t.Fatalf("Token() = %v, %v, want %v", tok, err, want)
+		}
+	}
+	var got [][]int
+	for dec.More() {
+		var ints []int
+		if err := dec.Decode(&ints); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, ints)
+	}
+	if tok, err := dec.Token(); err != nil || tok != (sexpr.EndList{}) {
+		t.Errorf("Token() = %v, %v, want EndList", tok, err)
+	}
+	if dec.More() {
+		t.Errorf("More() at EOF = true")
+	}
+	if want := [][]int{{1, 2}, {3}, nil}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %v, want %v", got, want)
+	}
+}
+
+// This example prints the field names of a stream of records,
+// indented by depth, in the style of gopl.io/ch7/xmlselect.
+func ExampleDecoder_Token() {
+	dec := sexpr.NewDecoder(strings.NewReader(`((Title "Bullitt") (Cast ((Lead "Steve McQueen"))))`))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Println(err)
+			return
+		}
+		switch tok := tok.(type) {
+		case sexpr.StartList:
+			depth++
+		case sexpr.EndList:
+			depth--
+		case sexpr.Symbol:
+			fmt.Printf("%*s%s\n", 2*depth, "", tok)
+		}
+	}
+	// Output:
+	//     Title
+	//     Cast
+	//         Lead
+}
+
+// A tick counts the values encoded so far.
+type tick struct{ n *int }
+
+func (t tick) MarshalSexpr() ([]byte, error) {
+	*t.n++
+	return []byte("tick"), nil
+}
+
+// A probe records how many ticks had been encoded at its first write.
+type probe struct {
+	strings.Builder
+	n, first *int
+}
+
+func (p *probe) Write(data []byte) (int, error) {
+	if *p.first < 0 {
+		*p.first = *p.n
+	}
+	return p.Builder.Write(data)
+}
+
+func TestEncoder(t *testing.T) {
+	type movie struct {
+		Title  string
+		Year   int
+		Oscars []string
+	}
+	movies := []movie{
+		{"Dr. Strangelove", 1964, []string{"Best Actor (Nomin.)", "Best Adapted Screenplay (Nomin.)"}},
+		{"Bullitt", 1968, nil},
+	}
+	for _, opts := range []*sexpr.IndentOptions{nil, {}, {Width: 20, Indent: 2}} {
+		var buf strings.Builder
+		enc := sexpr.NewEncoder(&buf)
+		if opts != nil {
+			enc.SetIndent(*opts)
+		}
+		var want strings.Builder
+		for _, m := range movies {
+			if err := enc.Encode(m); err != nil {
+				t.Fatal(err)
+			}
+			var data []byte
+			if opts == nil {
+				data, _ = sexpr.Marshal(m)
+			} else {
+				data, _ = sexpr.MarshalIndentOptions(m, *opts)
+			}
+			fmt.Fprintf(&want, "%s\n", data)
+		}
+		if buf.String() != want.String() {
+			t.Errorf("Encode(%v) with %+v =\n%s\nwant\n%s", movies, opts, buf.String(), want.String())
+		}
+
+		dec := sexpr.NewDecoder(strings.NewReader(buf.String()))
+		var got []movie
+		for dec.More() {
+			var m movie
+			if err := dec.Decode(&m); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, m)
+		}
+		if !reflect.DeepEqual(got, movies) {
+			t.Errorf("Decode(Encode(%v)) = %v", movies, got)
+		}
+
+		// A long list is written before all of it is encoded.
+		n, first := 0, -1
+		ticks := make([]tick, 10000)
+		for i := range ticks {
+			ticks[i].n = &n
+		}
+		enc = sexpr.NewEncoder(&probe{n: &n, first: &first})
+		if opts != nil {
+			enc.SetIndent(*opts)
+		}
+		if err := enc.Encode(ticks); err != nil {
+			t.Fatal(err)
+		}
+		if n != len(ticks) || first < 0 || first >= n/2 {
+			t.Errorf("Encode(%d ticks) with %+v: first write after %d ticks", n, opts, first)
+		}
+	}
+
+	if err := sexpr.NewEncoder(io.Discard).Encode(make(chan int)); err == nil {
+		t.Errorf("Encode(chan) succeeded, want error")
+	}
+}
+
+func TestEncoderCanonical(t *testing.T) {
+	m := make(map[int]string)
+	for i := 0; i < 20; i++ {
+		m[i] = fmt.Sprint(i)
+	}
+	sorted, err := sexpr.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []*sexpr.IndentOptions{nil, {Width: 40}} {
+		// Without canonical output, the entries are in iteration
+		// order, which is random, so one of a few encodings is
+		// almost certainly unsorted.
+		unsorted := false
+		for i := 0; i < 5; i++ {
+			var buf strings.Builder
+			enc := sexpr.NewEncoder(&buf)
+			enc.SetCanonical(false)
+			if opts != nil {
+				enc.SetIndent(*opts)
+			}
+			if err := enc.Encode(m); err != nil {
+				t.Fatal(err)
+			}
+			var got map[int]string
+			if err := sexpr.Unmarshal([]byte(buf.String()), &got); err != nil || !reflect.DeepEqual(got, m) {
+				t.Errorf("Unmarshal(%s) = %v, %v, want %v", buf.String(), got, err, m)
+			}
+			if strings.Join(strings.Fields(buf.String()), " ") != string(sorted) {
+				unsorted = true
+			}
+		}
+		if !unsorted {
+			t.Errorf("Encode with %+v and SetCanonical(false) sorted the map every time", opts)
+		}
+	}
+}
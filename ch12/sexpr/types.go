@@ -0,0 +1,51 @@
+package sexpr
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Interface values are encoded as ("type" value), where type is the
+// name of the dynamic type as printed by reflect.Type.String. To decode
+// them, Unmarshal needs the reflect.Type for each name, which it finds
+// in this table.
+
+var (
+	mu    sync.Mutex // guards types
+	types = make(map[string]reflect.Type)
+)
+
+func init() {
+	for _, v := range []interface{}{
+		false, "",
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0), uintptr(0),
+		float32(0), float64(0), complex64(0), complex128(0),
+		[]int(nil), []string(nil), []float64(nil), []interface{}(nil),
+		map[string]int(nil), map[string]string(nil), map[string]interface{}(nil),
+	} {
+		Register(v)
+	}
+}
+
+// Register records the dynamic type of v so that Unmarshal can decode
+// interface values of that type. Types of the same name registered
+// later replace earlier ones. Register panics if v is nil, which has
+// no type.
+func Register(v interface{}) {
+	if v == nil {
+		panic("sexpr: Register of nil value")
+	}
+	t := reflect.TypeOf(v)
+	mu.Lock()
+	types[t.String()] = t
+	mu.Unlock()
+}
+
+// lookup returns the registered type of the given name.
+func lookup(name string) (reflect.Type, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	t, ok := types[name]
+	return t, ok
+}
@@ -0,0 +1,239 @@
+package sexpr
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// A Value is an S-expression of any shape, decoded without reference
+// to a Go type: a Symbol, String, Int, Float, Macro, or List, or a
+// Comment within a list. Values
+// play the part for S-expressions that map[string]interface{} and
+// []interface{} play for JSON.
+//
+// Decoding into a variable of type Value, or into an interface{} at
+// the top level, yields a Value, and Marshal writes a Value back out
+// as the S-expression it was read from. Note that the symbols t and
+// nil are just Symbols: a Value has no notion of truth or of Go's nil.
+type Value interface {
+	value()
+}
+
+// A List is a parenthesized list of values. A list of pairs such as
+// ((Title "Dr. Strangelove") (Year 1964)) encodes a struct or a map;
+// its values may be found by key with Get.
+type List []Value
+
+// A Macro is a reader macro such as the #C of a complex number, the
+// label #1= of a shared value, or the quote ' of 'x, together with the
+// value that follows it. The reference #1# is a Symbol.
+type Macro struct {
+	Name  string
+	Datum Value
+}
+
+func (Symbol) value()  {}
+func (String) value()  {}
+func (Int) value()     {}
+func (Float) value()   {}
+func (List) value()    {}
+func (Macro) value()   {}
+func (Comment) value() {}
+
+var (
+	valueType      = reflect.TypeOf((*Value)(nil)).Elem()
+	symbolType     = reflect.TypeOf(Symbol(""))
+	floatValueType = reflect.TypeOf(Float(0))
+	macroType      = reflect.TypeOf(Macro{})
+	commentType    = reflect.TypeOf(Comment(""))
+)
+
+// Get returns the value of the first pair (key value) of l whose key
+// is the symbol or string name. Symbols match regardless of case, as
+// struct field names do in Unmarshal.
+func (l List) Get(name string) (Value, bool) {
+	for _, item := range l {
+		if pair, ok := unlabel(item).(List); ok && len(pair) == 2 &&
+			keyMatches(Symbol(name), pair[0]) {
+			return pair[1], true
+		}
+	}
+	return nil, false
+}
+
+// Lookup returns the value found by following path from v. Each
+// element of path is either a string, which selects the value of a
+// pair of a list as Get does, or an int, which selects an element of a
+// list, not counting comments. The labels #n= of values along the
+// path are skipped.
+//
+// For example, if movie holds
+//
+//	((Title "Dr. Strangelove") (Oscars ("Best Actor" "Best Picture")))
+//
+// then Lookup(movie, "Oscars", 1) returns String("Best Picture").
+func Lookup(v Value, path ...interface{}) (Value, bool) {
+	for _, step := range path {
+		list, ok := unlabel(v).(List)
+		if !ok {
+			return nil, false
+		}
+		list = uncommented(list)
+		switch step := step.(type) {
+		case string:
+			if v, ok = list.Get(step); !ok {
+				return nil, false
+			}
+		case int:
+			if step < 0 || step >= len(list) {
+				return nil, false
+			}
+			v = list[step]
+		default:
+			panic(fmt.Sprintf("sexpr: Lookup path element of type %T", step))
+		}
+	}
+	return unlabel(v), true
+}
+
+// unlabel returns the value labeled by v if v is a label #n=value,
+// and v otherwise.
+func unlabel(v Value) Value {
+	for {
+		m, ok := v.(Macro)
+		if !ok || !strings.HasSuffix(m.Name, "=") {
+			return v
+		}
+		v = m.Datum
+	}
+}
+
+// uncommented returns the elements of l other than comments.
+func uncommented(l List) List {
+	var values List
+	for i, item := range l {
+		if _, ok := item.(Comment); ok {
+			if values == nil {
+				values = append(List{}, l[:i]...)
+			}
+		} else if values != nil {
+			values = append(values, item)
+		}
+	}
+	if values == nil {
+		return l
+	}
+	return values
+}
+
+// isValueType reports whether t is a type of the dynamic model that
+// must be read by readValue, rather than by reflection on its kind.
+// String, Int, Float and List read correctly either way.
+func isValueType(t reflect.Type) bool {
+	return t == valueType || t == symbolType || t == macroType || t == commentType
+}
+
+// readGeneric reads the next value into v, a variable of one of the
+// types of the dynamic model.
+func (dec *Decoder) readGeneric(v reflect.Value) error {
+	pos := dec.lex.scan.Position
+	tree, err := readValue(dec)
+	if err != nil {
+		return err
+	}
+	dec.peek() // read leaves the next token in lex.token
+	if m, ok := tree.(Macro); ok && m.Name == "'" && v.Type() != valueType {
+		tree = m.Datum // 'x is x, except as a Value
+	}
+	tv := reflect.ValueOf(tree)
+	if !tv.Type().AssignableTo(v.Type()) {
+		return &UnmarshalTypeError{pos, describeValue(tree), v.Type()}
+	}
+	v.Set(tv)
+	return dec.lex.err
+}
+
+// describeValue returns a description of v for errors.
+func describeValue(v Value) string {
+	switch v := v.(type) {
+	case Symbol:
+		return "symbol " + string(v)
+	case String:
+		return "string"
+	case Int, Float:
+		return fmt.Sprintf("number %v", v)
+	case Macro:
+		return v.Name + " value"
+	case Comment:
+		return "comment"
+	}
+	return "list"
+}
+
+// readTree reads the next value from dec. At the end of a list, it
+// returns errEndList.
+func readTree(dec *Decoder) (Value, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok := tok.(type) {
+	case StartList:
+		list := List{}
+		for {
+			item, err := readTree(dec)
+			if err == errEndList {
+				return list, nil
+			} else if err == io.EOF {
+				return nil, &SyntaxError{dec.lex.scan.Position, "unexpected end of input"}
+			} else if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+	case EndList:
+		return nil, errEndList
+	case Symbol:
+		if isMacro(string(tok)) {
+			datum, err := readDatum(dec)
+			if err == io.EOF || err == errEndList {
+				return nil, &SyntaxError{dec.lex.scan.Position, "missing value after " + string(tok)}
+			} else if err != nil {
+				return nil, err
+			}
+			return Macro{string(tok), datum}, nil
+		}
+	}
+	return tok.(Value), nil
+}
+
+var errEndList = fmt.Errorf("unexpected )")
+
+// readDatum reads the next value from dec, skipping comments.
+func readDatum(dec *Decoder) (Value, error) {
+	for {
+		tree, err := readTree(dec)
+		if _, ok := tree.(Comment); !ok || err != nil {
+			return tree, err
+		}
+	}
+}
+
+// readValue reads the next top-level value from dec as a tree. Comments
+// outside the value are discarded.
+func readValue(dec *Decoder) (Value, error) {
+	tree, err := readDatum(dec)
+	if err == errEndList {
+		return nil, &SyntaxError{dec.lex.scan.Position, "unexpected \")\""}
+	}
+	return tree, err
+}
+
+// isMacro reports whether the symbol s is a reader macro that takes
+// the following value, such as #C, #1= or ', rather than a symbol such
+// as the reference #1#.
+func isMacro(s string) bool {
+	return s == "'" || strings.HasPrefix(s, "#") && !strings.HasSuffix(s, "#")
+}
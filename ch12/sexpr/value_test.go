@@ -0,0 +1,236 @@
+package sexpr
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	const input = `((Title "Dr. Strangelove") (Year 1964) (Rating 8.4) (Color nil) ` +
+		`(Oscars ("Best Actor" "Best Picture")) (Score #C(1 -2)) ` +
+		`(Sequel #1=((Title "Dr. Strangelove II") (Prequel #1#))))`
+	var doc interface{}
+	if err := Unmarshal([]byte(input), &doc); err != nil {
+		t.Fatal(err)
+	}
+	movie, ok := doc.(List)
+	if !ok {
+		t.Fatalf("Unmarshal into interface{} = %T, want List", doc)
+	}
+
+	// Marshal writes the value back out as it was read.
+	data, err := Marshal(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != input {
+		t.Errorf("Marshal(value) = %s, want %s", data, input)
+	}
+	data, err = MarshalIndent(movie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(strings.Fields(string(data)), " "); got != input {
+		t.Errorf("MarshalIndent(value) = %s, want %s", data, input)
+	}
+	if !strings.Contains(string(data), "\n") {
+		t.Errorf("MarshalIndent(value) = %s, want several lines", data)
+	}
+
+	for _, test := range []struct {
+		path []interface{}
+		want Value
+		ok   bool
+	}{
+		{[]interface{}{"Title"}, String("Dr. Strangelove"), true},
+		{[]interface{}{"year"}, Int(1964), true},
+		{[]interface{}{"Rating"}, Float(8.4), true},
+		{[]interface{}{"Color"}, Symbol("nil"), true},
+		{[]interface{}{"Oscars", 1}, String("Best Picture"), true},
+		{[]interface{}{"Oscars", 2}, nil, false},
+		{[]interface{}{"Score"}, Macro{"#C", List{Int(1), Int(-2)}}, true},
+		{[]interface{}{"Sequel", "Prequel"}, Symbol("#1#"), true},
+		{[]interface{}{"Title", "Subtitle"}, nil, false},
+		{[]interface{}{"Director"}, nil, false},
+	} {
+		got, ok := Lookup(movie, test.path...)
+		if ok != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Lookup(%v) = %#v, %t, want %#v, %t",
+				test.path, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestFloatValue(t *testing.T) {
+	// An integral Float reads back as a Float, not an Int.
+	for _, v := range []Value{Float(2), Float(-1e21), List{Symbol("F"), Float(0)}} {
+		for _, marshal := range []func(interface{}) ([]byte, error){Marshal, MarshalIndent} {
+			data, err := marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var back Value
+			if err := Unmarshal(data, &back); err != nil || !reflect.DeepEqual(back, v) {
+				t.Errorf("Unmarshal(%s) = %#v, %v, want %#v", data, back, err, v)
+			}
+		}
+	}
+	var v Value
+	if err := Unmarshal([]byte("((F 2.0))"), &v); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := Marshal(v); err != nil || string(data) != "((F 2.0))" {
+		t.Errorf("Marshal(%#v) = %s, %v, want ((F 2.0))", v, data, err)
+	}
+}
+
+func TestValueFields(t *testing.T) {
+	type config struct {
+		Name  string
+		Extra Value  // any S-expression
+		Mode  Symbol // an unquoted symbol
+		Rest  List
+	}
+	const input = `((Name "x") (Extra (a "b" (1 2.5))) (Mode fast) (Rest (c #C(0 1))))`
+	var c config
+	if err := Unmarshal([]byte(input), &c); err != nil {
+		t.Fatal(err)
+	}
+	want := config{
+		Name:  "x",
+		Extra: List{Symbol("a"), String("b"), List{Int(1), Float(2.5)}},
+		Mode:  "fast",
+		Rest:  List{Symbol("c"), Macro{"#C", List{Int(0), Int(1)}}},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Unmarshal(%s) = %#v, want %#v", input, c, want)
+	}
+	data, err := Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != input {
+		t.Errorf("Marshal(%#v) = %s, want %s", c, data, input)
+	}
+
+	for _, input := range []string{`((Mode "fast"))`, `((Mode (a b)))`, `((Extra (a b)`} {
+		if err := Unmarshal([]byte(input), &c); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded, want error", input)
+		}
+	}
+}
+
+const config = `;; server configuration
+((name "gopl") ; the name
+ (max-results 10)
+ (mode 'fast)
+ (tags ("a" "b" 'c))
+ ;; the end
+ )`
+
+func TestLispSyntax(t *testing.T) {
+	newDecoder := func(input string) *Decoder {
+		dec := NewDecoder(strings.NewReader(input))
+		dec.UseLispSyntax()
+		return dec
+	}
+
+	// Comments are kept within lists of a Value.
+	var v Value
+	if err := newDecoder(config).Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	want := List{
+		List{Symbol("name"), String("gopl")},
+		Comment(" the name"),
+		List{Symbol("max-results"), Int(10)},
+		List{Symbol("mode"), Macro{"'", Symbol("fast")}},
+		List{Symbol("tags"), List{String("a"), String("b"), Macro{"'", Symbol("c")}}},
+		Comment("; the end"),
+	}
+	if !reflect.DeepEqual(v, want) {
+		t.Errorf("Decode(config) = %#v, want %#v", v, want)
+	}
+	if got, ok := Lookup(v, "max-results"); !ok || got != Int(10) {
+		t.Errorf(`Lookup(config, "max-results") = %#v, %t`, got, ok)
+	}
+	if got, ok := Lookup(v, 1); !ok || !reflect.DeepEqual(got, want[2]) {
+		t.Errorf("Lookup(config, 1) = %#v, %t, want %#v", got, ok, want[2])
+	}
+	matches, err := Select(v, "*")
+	if err != nil || len(matches) != 4 || matches[1].Path != "max-results" {
+		t.Errorf("Select(config, *) = %v, %v", matches, err)
+	}
+
+	// Typed decoding discards comments and quotes, and matches
+	// dashed symbols to field names.
+	var c struct {
+		Name       string
+		MaxResults int
+		Mode       Symbol
+		Tags       []Value
+	}
+	if err := newDecoder(config).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "gopl" || c.MaxResults != 10 || c.Mode != "fast" || len(c.Tags) != 3 {
+		t.Errorf("Decode(config) = %+v", c)
+	}
+
+	// Without Lisp syntax, the input is malformed.
+	for _, input := range []string{config, `(max-results 10)`, `('x)`} {
+		var v Value
+		if err := Unmarshal([]byte(input), &v); err == nil {
+			t.Errorf("Unmarshal(%s) = %#v, want error", input, v)
+		}
+	}
+}
+
+func TestMarshalIndentOptions(t *testing.T) {
+	var v Value
+	dec := NewDecoder(strings.NewReader(config))
+	dec.UseLispSyntax()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		opts IndentOptions
+		want string
+	}{
+		{IndentOptions{}, `((name "gopl") ; the name
+ (max-results 10) (mode 'fast) (tags ("a" "b" 'c)) ;; the end
+ )`},
+		{IndentOptions{Width: 30, Indent: 2}, `((name "gopl") ; the name
+  (max-results 10)
+  (mode 'fast)
+  (tags ("a" "b" 'c)) ;; the end
+  )`},
+	} {
+		data, err := MarshalIndentOptions(v, test.opts)
+		if err != nil {
+			t.Errorf("MarshalIndentOptions(%+v): %v", test.opts, err)
+		} else if string(data) != test.want {
+			t.Errorf("MarshalIndentOptions(%+v) = %s, want %s", test.opts, data, test.want)
+		}
+	}
+
+	// A comment after a comment begins a line of its own.
+	data, err := MarshalIndent(List{Int(1), Comment(" a"), Comment(" b"), Int(2)})
+	if want := "(1 ; a\n ; b\n 2)"; err != nil || string(data) != want {
+		t.Errorf("MarshalIndent of comments = %q, %v, want %q", data, err, want)
+	}
+
+	// Marshal ends each comment's line.
+	data, err = Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Value
+	dec = NewDecoder(bytes.NewReader(data))
+	dec.UseLispSyntax()
+	if err := dec.Decode(&back); err != nil || !reflect.DeepEqual(back, v) {
+		t.Errorf("Decode(Marshal(config)) = %#v, %v, want %#v", back, err, v)
+	}
+}
@@ -0,0 +1,59 @@
+// Sexprconv converts between S-expressions and JSON or XML, using the
+// mapping described in gopl.io/ch12/sexpr.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopl.io/ch12/sexpr"
+)
+
+var (
+	from = flag.String("from", "sexpr", "input format: sexpr, json or xml")
+	to   = flag.String("to", "sexpr", "output format: sexpr, json or xml")
+)
+
+func main() {
+	flag.Parse()
+	var convert func(w io.Writer, r io.Reader) error
+	switch {
+	case *from == "sexpr" && *to == "json":
+		convert = sexpr.ToJSON
+	case *from == "sexpr" && *to == "xml":
+		convert = sexpr.ToXML
+	case *from == "json" && *to == "sexpr":
+		convert = sexpr.FromJSON
+	case *from == "xml" && *to == "sexpr":
+		convert = sexpr.FromXML
+	default:
+		fmt.Fprintf(os.Stderr, "sexprconv: cannot convert %s to %s; "+
+			"one of -from and -to must be sexpr\n", *from, *to)
+		os.Exit(2)
+	}
+	if err := convert(os.Stdout, os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "sexprconv: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+/*
+Run:
+$ go build gopl.io/ch12/sexprconv
+$ echo '((Title "Bullitt") (Year 1968) (Color t) (Actors ("Steve McQueen")) (Sequel nil))' |
+	./sexprconv -to json
+{"Title":"Bullitt","Year":1968,"Color":true,"Actors":["Steve McQueen"],"Sequel":null}
+
+$ echo '((Title "Bullitt") (Year 1968))' | ./sexprconv -to json |
+	jq -c '.Year += 1' | ./sexprconv -from json
+((Title "Bullitt") (Year 1969))
+
+$ echo '((Title "Bullitt") (Rating #C(1 -2)) (Cast (("Lead" "Steve McQueen"))))' |
+	./sexprconv -to xml
+<object><Title><string>Bullitt</string></Title><Rating><macro name="#C"><list><int>1</int><int>-2</int></list></macro></Rating><Cast><list><list><string>Lead</string><string>Steve McQueen</string></list></list></Cast></object>
+
+$ echo '((Title "Bullitt") (Rating #C(1 -2)))' | ./sexprconv -to xml | ./sexprconv -from xml
+((Title "Bullitt") (Rating #C(1 -2)))
+*/
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// check type-checks the source of a package with no imports.
+func check(t *testing.T, src string) *types.Package {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", "package p\n"+src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := new(types.Config).Check("p", fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+func TestRecursive(t *testing.T) {
+	for _, test := range []struct {
+		src   string
+		names []string
+		ok    bool
+	}{
+		{"type T struct{ Next *T }", []string{"T"}, false},
+		{"type T struct{ Kids []T }", []string{"T"}, false},
+		{"type T struct{ Index map[string][2]*T }", []string{"T"}, false},
+		{"type A struct{ B *B }; type B struct{ A []A }", []string{"A", "B"}, false},
+		{"type A struct{ B *B }; type B struct{ A []A }", []string{"B", "A"}, false},
+		// Without B, its fields are left to package sexpr.
+		{"type A struct{ B *B }; type B struct{ A []A }", []string{"A"}, true},
+		{"type A struct{ B, C *B }; type B struct{ S string }", []string{"A", "B"}, true},
+	} {
+		_, err := generate(check(t, test.src), test.names, nil)
+		if (err == nil) != test.ok {
+			t.Errorf("generate(%q, %v) = %v, want ok %t", test.src, test.names, err, test.ok)
+		}
+	}
+}
+
+func TestImports(t *testing.T) {
+	// A field named like a package must not import it.
+	pkg := check(t, "type T struct{ S string `sexpr:\"sort.by\"`; N int8 }")
+	src, err := generate(pkg, []string{"T"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imports := string(src[:strings.Index(string(src), ")")])
+	for _, path := range []string{"bytes", "fmt", "io", "math", "strconv", "strings", "gopl.io/ch12/sexpr"} {
+		if !strings.Contains(imports, `"`+path+`"`) {
+			t.Errorf("generated code does not import %s", path)
+		}
+	}
+	if strings.Contains(imports, `"sort"`) {
+		t.Errorf("generated code imports sort, which it does not use")
+	}
+}
@@ -0,0 +1,39 @@
+// Package movie declares the types whose methods are generated by
+// gopl.io/ch12/sexprgen in movie_sexpr.go. Its tests check that the
+// generated code encodes exactly as gopl.io/ch12/sexpr does, and
+// compare their speeds.
+package movie
+
+import "time"
+
+//go:generate go run gopl.io/ch12/sexprgen -type=Movie,Review
+
+// A Movie is the struct of the tests of gopl.io/ch12/sexpr.
+type Movie struct {
+	Title, Subtitle string
+	Year            int
+	Actor           map[string]string
+	Oscars          []string
+	Sequel          *string
+}
+
+// A Review has fields of the other kinds that sexprgen handles,
+// including some it leaves to package sexpr.
+type Review struct {
+	Film     *Movie
+	Critic   string            `sexpr:"by"`
+	Stars    uint8             `json:"stars,omitempty"`
+	Score    float32           `sexpr:",omitempty"`
+	Weights  map[int][]float64 // keys sorted by encoding
+	Best     [2]string
+	Watched  bool
+	Rating   Rating
+	Runtime  time.Duration // left to package sexpr
+	Note     interface{}   // left to package sexpr
+	Related  []Movie
+	Internal string `sexpr:"-"`
+	private  int
+}
+
+// A Rating is a named numeric type.
+type Rating int8
@@ -0,0 +1,906 @@
+// Code generated by "sexprgen -type=Movie,Review"; DO NOT EDIT.
+
+package movie
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopl.io/ch12/sexpr"
+)
+
+// MarshalSexpr encodes x as sexpr.Marshal would.
+func (x Movie) MarshalSexpr() ([]byte, error) {
+	return x.appendSexpr(nil)
+}
+
+// appendSexpr appends the encoding of x to buf.
+func (x *Movie) appendSexpr(buf []byte) ([]byte, error) {
+	buf = append(buf, '(')
+	start := len(buf)
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Title "...)
+	buf = strconv.AppendQuote(buf, x.Title)
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Subtitle "...)
+	buf = strconv.AppendQuote(buf, x.Subtitle)
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Year "...)
+	buf = strconv.AppendInt(buf, int64(x.Year), 10)
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Actor "...)
+	{
+		keys0 := make([]struct {
+			data []byte
+			key  string
+		}, 0, len(x.Actor))
+		for k0 := range x.Actor {
+			buf := []byte(nil)
+			buf = strconv.AppendQuote(buf, k0)
+			keys0 = append(keys0, struct {
+				data []byte
+				key  string
+			}{buf, k0})
+		}
+		sort.Slice(keys0, func(i, j int) bool {
+			return bytes.Compare(keys0[i].data, keys0[j].data) < 0
+		})
+		buf = append(buf, '(')
+		for i0, k0 := range keys0 {
+			if i0 > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, '(')
+			buf = append(buf, k0.data...)
+			buf = append(buf, ' ')
+			v0 := x.Actor[k0.key]
+			buf = strconv.AppendQuote(buf, v0)
+			buf = append(buf, ')')
+		}
+		buf = append(buf, ')')
+	}
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Oscars "...)
+	buf = append(buf, '(')
+	for i0 := range x.Oscars {
+		if i0 > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = strconv.AppendQuote(buf, x.Oscars[i0])
+	}
+	buf = append(buf, ')')
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Sequel "...)
+	if x.Sequel == nil {
+		buf = append(buf, "nil"...)
+	} else {
+		buf = strconv.AppendQuote(buf, (*x.Sequel))
+	}
+	buf = append(buf, ')')
+	return append(buf, ')'), nil
+}
+
+// UnmarshalSexpr decodes data into x as sexpr.Unmarshal would.
+func (x *Movie) UnmarshalSexpr(data []byte) error {
+	dec := sexpr.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	orig := *x
+	if err := x.decodeSexpr(dec, tok); err == movieSexprErrLabel {
+		// Start again, leaving the labels to package sexpr.
+		*x = orig
+		return sexpr.Unmarshal(data, (*movieSexprPlainMovie)(x))
+	} else if err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("sexpr: unexpected data after Movie value")
+		}
+		return err
+	}
+	return nil
+}
+
+var movieSexprFieldsMovie = []string{"Title", "Subtitle", "Year", "Actor", "Oscars", "Sequel"}
+
+// movieSexprPlainMovie has the fields of Movie but not its methods, so
+// package sexpr decodes it by reflection.
+type movieSexprPlainMovie Movie
+
+// decodeSexpr decodes the value that begins with tok into x.
+func (x *Movie) decodeSexpr(dec *sexpr.Decoder, tok sexpr.Token) error {
+	if ok, err := movieSexprList(tok, "Movie"); !ok {
+		if err == nil {
+			*x = Movie{}
+		}
+		return err
+	}
+	for dec.More() {
+		i, err := movieSexprField(dec, movieSexprFieldsMovie)
+		if err != nil {
+			return err
+		}
+		switch i {
+		case 0:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprString(tok, "string")
+				if err != nil {
+					return err
+				}
+				x.Title = v
+			}
+		case 1:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprString(tok, "string")
+				if err != nil {
+					return err
+				}
+				x.Subtitle = v
+			}
+		case 2:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprInt(tok, strconv.IntSize, "int")
+				if err != nil {
+					return err
+				}
+				x.Year = int(v)
+			}
+		case 3:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if ok, err := movieSexprList(tok, "map[string]string"); err != nil {
+					return err
+				} else if !ok {
+					x.Actor = nil
+				} else {
+					x.Actor = make(map[string]string)
+					for dec.More() {
+						if err := movieSexprStart(dec); err != nil {
+							return err
+						}
+						var k0 string
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							v, err := movieSexprString(tok, "string")
+							if err != nil {
+								return err
+							}
+							k0 = v
+						}
+						var v0 string
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							v, err := movieSexprString(tok, "string")
+							if err != nil {
+								return err
+							}
+							v0 = v
+						}
+						x.Actor[k0] = v0
+						if err := movieSexprEnd(dec); err != nil {
+							return err
+						}
+					}
+					if err := movieSexprEnd(dec); err != nil {
+						return err
+					}
+				}
+			}
+		case 4:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if ok, err := movieSexprList(tok, "[]string"); err != nil {
+					return err
+				} else if !ok {
+					x.Oscars = nil
+				} else {
+					for dec.More() {
+						var e0 string
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							v, err := movieSexprString(tok, "string")
+							if err != nil {
+								return err
+							}
+							e0 = v
+						}
+						x.Oscars = append(x.Oscars, e0)
+					}
+					if err := movieSexprEnd(dec); err != nil {
+						return err
+					}
+				}
+			}
+		case 5:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if movieSexprIsLabel(tok) {
+					return movieSexprErrLabel
+				}
+				if movieSexprIsNil(tok) {
+					x.Sequel = nil
+				} else {
+					if x.Sequel == nil {
+						x.Sequel = new(string)
+					}
+					v, err := movieSexprString(tok, "string")
+					if err != nil {
+						return err
+					}
+					(*x.Sequel) = v
+				}
+			}
+		default: // unknown field
+			var skip sexpr.Value
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+		if err := movieSexprEnd(dec); err != nil {
+			return err
+		}
+	}
+	return movieSexprEnd(dec)
+}
+
+// MarshalSexpr encodes x as sexpr.Marshal would.
+func (x Review) MarshalSexpr() ([]byte, error) {
+	return x.appendSexpr(nil)
+}
+
+// appendSexpr appends the encoding of x to buf.
+func (x *Review) appendSexpr(buf []byte) ([]byte, error) {
+	buf = append(buf, '(')
+	start := len(buf)
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Film "...)
+	if x.Film == nil {
+		buf = append(buf, "nil"...)
+	} else {
+		{
+			var err error
+			if buf, err = (*x.Film).appendSexpr(buf); err != nil {
+				return nil, err
+			}
+		}
+	}
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(by "...)
+	buf = strconv.AppendQuote(buf, x.Critic)
+	buf = append(buf, ')')
+	if x.Stars != 0 {
+		if len(buf) > start {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "(stars "...)
+		buf = strconv.AppendUint(buf, uint64(x.Stars), 10)
+		buf = append(buf, ')')
+	}
+	if x.Score != 0 {
+		if len(buf) > start {
+			buf = append(buf, ' ')
+		}
+		buf = append(buf, "(Score "...)
+		if f := float64(x.Score); math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, fmt.Errorf("unsupported value: %g", f)
+		}
+		buf = strconv.AppendFloat(buf, float64(x.Score), 'g', -1, 32)
+		buf = append(buf, ')')
+	}
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Weights "...)
+	{
+		keys0 := make([]struct {
+			data []byte
+			key  int
+		}, 0, len(x.Weights))
+		for k0 := range x.Weights {
+			buf := []byte(nil)
+			buf = strconv.AppendInt(buf, int64(k0), 10)
+			keys0 = append(keys0, struct {
+				data []byte
+				key  int
+			}{buf, k0})
+		}
+		sort.Slice(keys0, func(i, j int) bool {
+			return bytes.Compare(keys0[i].data, keys0[j].data) < 0
+		})
+		buf = append(buf, '(')
+		for i0, k0 := range keys0 {
+			if i0 > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = append(buf, '(')
+			buf = append(buf, k0.data...)
+			buf = append(buf, ' ')
+			v0 := x.Weights[k0.key]
+			buf = append(buf, '(')
+			for i1 := range v0 {
+				if i1 > 0 {
+					buf = append(buf, ' ')
+				}
+				if f := v0[i1]; math.IsInf(f, 0) || math.IsNaN(f) {
+					return nil, fmt.Errorf("unsupported value: %g", f)
+				}
+				buf = strconv.AppendFloat(buf, v0[i1], 'g', -1, 64)
+			}
+			buf = append(buf, ')')
+			buf = append(buf, ')')
+		}
+		buf = append(buf, ')')
+	}
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Best "...)
+	buf = append(buf, '(')
+	for i0 := range x.Best {
+		if i0 > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = strconv.AppendQuote(buf, x.Best[i0])
+	}
+	buf = append(buf, ')')
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Watched "...)
+	if x.Watched {
+		buf = append(buf, 't')
+	} else {
+		buf = append(buf, "nil"...)
+	}
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Rating "...)
+	buf = strconv.AppendInt(buf, int64(x.Rating), 10)
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Runtime "...)
+	{
+		data, err := sexpr.Marshal(x.Runtime)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, data...)
+	}
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Note "...)
+	{
+		data, err := sexpr.Marshal(&x.Note)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, data...)
+	}
+	buf = append(buf, ')')
+	if len(buf) > start {
+		buf = append(buf, ' ')
+	}
+	buf = append(buf, "(Related "...)
+	buf = append(buf, '(')
+	for i0 := range x.Related {
+		if i0 > 0 {
+			buf = append(buf, ' ')
+		}
+		{
+			var err error
+			if buf, err = x.Related[i0].appendSexpr(buf); err != nil {
+				return nil, err
+			}
+		}
+	}
+	buf = append(buf, ')')
+	buf = append(buf, ')')
+	return append(buf, ')'), nil
+}
+
+// UnmarshalSexpr decodes data into x as sexpr.Unmarshal would.
+func (x *Review) UnmarshalSexpr(data []byte) error {
+	dec := sexpr.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	orig := *x
+	if err := x.decodeSexpr(dec, tok); err == movieSexprErrLabel {
+		// Start again, leaving the labels to package sexpr.
+		*x = orig
+		return sexpr.Unmarshal(data, (*movieSexprPlainReview)(x))
+	} else if err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = fmt.Errorf("sexpr: unexpected data after Review value")
+		}
+		return err
+	}
+	return nil
+}
+
+var movieSexprFieldsReview = []string{"Film", "by", "stars", "Score", "Weights", "Best", "Watched", "Rating", "Runtime", "Note", "Related"}
+
+// movieSexprPlainReview has the fields of Review but not its methods, so
+// package sexpr decodes it by reflection.
+type movieSexprPlainReview Review
+
+// decodeSexpr decodes the value that begins with tok into x.
+func (x *Review) decodeSexpr(dec *sexpr.Decoder, tok sexpr.Token) error {
+	if ok, err := movieSexprList(tok, "Review"); !ok {
+		if err == nil {
+			*x = Review{}
+		}
+		return err
+	}
+	for dec.More() {
+		i, err := movieSexprField(dec, movieSexprFieldsReview)
+		if err != nil {
+			return err
+		}
+		switch i {
+		case 0:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if movieSexprIsLabel(tok) {
+					return movieSexprErrLabel
+				}
+				if movieSexprIsNil(tok) {
+					x.Film = nil
+				} else {
+					if x.Film == nil {
+						x.Film = new(Movie)
+					}
+					if err := (*x.Film).decodeSexpr(dec, tok); err != nil {
+						return err
+					}
+				}
+			}
+		case 1:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprString(tok, "string")
+				if err != nil {
+					return err
+				}
+				x.Critic = v
+			}
+		case 2:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprUint(tok, 8, "uint8")
+				if err != nil {
+					return err
+				}
+				x.Stars = uint8(v)
+			}
+		case 3:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprFloat(tok, 32, "float32")
+				if err != nil {
+					return err
+				}
+				x.Score = float32(v)
+			}
+		case 4:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if ok, err := movieSexprList(tok, "map[int][]float64"); err != nil {
+					return err
+				} else if !ok {
+					x.Weights = nil
+				} else {
+					x.Weights = make(map[int][]float64)
+					for dec.More() {
+						if err := movieSexprStart(dec); err != nil {
+							return err
+						}
+						var k0 int
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							v, err := movieSexprInt(tok, strconv.IntSize, "int")
+							if err != nil {
+								return err
+							}
+							k0 = int(v)
+						}
+						var v0 []float64
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							if ok, err := movieSexprList(tok, "[]float64"); err != nil {
+								return err
+							} else if !ok {
+								v0 = nil
+							} else {
+								for dec.More() {
+									var e1 float64
+									{
+										tok, err := dec.Token()
+										if err != nil {
+											return err
+										}
+										v, err := movieSexprFloat(tok, 64, "float64")
+										if err != nil {
+											return err
+										}
+										e1 = v
+									}
+									v0 = append(v0, e1)
+								}
+								if err := movieSexprEnd(dec); err != nil {
+									return err
+								}
+							}
+						}
+						x.Weights[k0] = v0
+						if err := movieSexprEnd(dec); err != nil {
+							return err
+						}
+					}
+					if err := movieSexprEnd(dec); err != nil {
+						return err
+					}
+				}
+			}
+		case 5:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if ok, err := movieSexprList(tok, "[2]string"); err != nil {
+					return err
+				} else if !ok {
+					x.Best = [2]string{}
+				} else {
+					for i0 := 0; dec.More(); i0++ {
+						if i0 == len(x.Best) {
+							return fmt.Errorf("sexpr: cannot unmarshal list of more than %d elements into Go value of type %s", i0, "[2]string")
+						}
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							v, err := movieSexprString(tok, "string")
+							if err != nil {
+								return err
+							}
+							x.Best[i0] = v
+						}
+					}
+					if err := movieSexprEnd(dec); err != nil {
+						return err
+					}
+				}
+			}
+		case 6:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprBool(tok, "bool")
+				if err != nil {
+					return err
+				}
+				x.Watched = v
+			}
+		case 7:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				v, err := movieSexprInt(tok, 8, "Rating")
+				if err != nil {
+					return err
+				}
+				x.Rating = Rating(v)
+			}
+		case 8:
+			if err := dec.Decode(&x.Runtime); err != nil {
+				return err
+			}
+		case 9:
+			{
+				p := &x.Note
+				if err := dec.Decode(&p); err != nil {
+					return err
+				}
+				if p == nil {
+					x.Note = nil
+				} else {
+					x.Note = *p
+				}
+			}
+		case 10:
+			{
+				tok, err := dec.Token()
+				if err != nil {
+					return err
+				}
+				if ok, err := movieSexprList(tok, "[]Movie"); err != nil {
+					return err
+				} else if !ok {
+					x.Related = nil
+				} else {
+					for dec.More() {
+						var e0 Movie
+						{
+							tok, err := dec.Token()
+							if err != nil {
+								return err
+							}
+							if err := e0.decodeSexpr(dec, tok); err != nil {
+								return err
+							}
+						}
+						x.Related = append(x.Related, e0)
+					}
+					if err := movieSexprEnd(dec); err != nil {
+						return err
+					}
+				}
+			}
+		default: // unknown field
+			var skip sexpr.Value
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+		if err := movieSexprEnd(dec); err != nil {
+			return err
+		}
+	}
+	return movieSexprEnd(dec)
+}
+
+// movieSexprTypeError returns the error for a token that does not begin a
+// value of the named type.
+func movieSexprTypeError(tok sexpr.Token, typ string) error {
+	var what string
+	switch tok := tok.(type) {
+	case sexpr.StartList:
+		what = "list"
+	case sexpr.EndList:
+		what = "\")\""
+	case sexpr.Symbol:
+		what = "symbol " + string(tok)
+	case sexpr.String:
+		what = "string"
+	default:
+		what = fmt.Sprintf("number %v", tok)
+	}
+	return fmt.Errorf("sexpr: cannot unmarshal %s into Go value of type %s", what, typ)
+}
+
+// movieSexprErrLabel is returned by the generated decoders on meeting a
+// label #n= or #n#, which only package sexpr can follow.
+var movieSexprErrLabel = fmt.Errorf("sexpr: datum label")
+
+// movieSexprIsLabel reports whether tok is a label #n= or #n#.
+func movieSexprIsLabel(tok sexpr.Token) bool {
+	s, ok := tok.(sexpr.Symbol)
+	return ok && len(s) > 2 && s[0] == '#' && (s[len(s)-1] == '=' || s[len(s)-1] == '#')
+}
+
+// movieSexprIsNil reports whether tok is the symbol nil, which decodes as
+// the zero value of any type.
+func movieSexprIsNil(tok sexpr.Token) bool {
+	s, ok := tok.(sexpr.Symbol)
+	return ok && s == "nil"
+}
+
+func movieSexprBool(tok sexpr.Token, typ string) (bool, error) {
+	if s, ok := tok.(sexpr.Symbol); ok && (s == "t" || s == "nil") {
+		return s == "t", nil
+	}
+	return false, movieSexprTypeError(tok, typ)
+}
+
+func movieSexprInt(tok sexpr.Token, bits int, typ string) (int64, error) {
+	if i, ok := tok.(sexpr.Int); ok {
+		if n := int64(i) >> (bits - 1); n == 0 || n == -1 {
+			return int64(i), nil
+		}
+	} else if movieSexprIsNil(tok) {
+		return 0, nil
+	}
+	return 0, movieSexprTypeError(tok, typ)
+}
+
+func movieSexprUint(tok sexpr.Token, bits int, typ string) (uint64, error) {
+	if i, ok := tok.(sexpr.Int); ok {
+		if i >= 0 && (bits == 64 || uint64(i)>>bits == 0) {
+			return uint64(i), nil
+		}
+	} else if movieSexprIsNil(tok) {
+		return 0, nil
+	}
+	return 0, movieSexprTypeError(tok, typ)
+}
+
+func movieSexprFloat(tok sexpr.Token, bits int, typ string) (float64, error) {
+	switch tok := tok.(type) {
+	case sexpr.Int:
+		return float64(tok), nil
+	case sexpr.Float:
+		if bits == 64 || math.Abs(float64(tok)) <= math.MaxFloat32 {
+			return float64(tok), nil
+		}
+	case sexpr.Symbol:
+		if tok == "nil" {
+			return 0, nil
+		}
+	}
+	return 0, movieSexprTypeError(tok, typ)
+}
+
+func movieSexprString(tok sexpr.Token, typ string) (string, error) {
+	if s, ok := tok.(sexpr.String); ok {
+		return string(s), nil
+	} else if movieSexprIsNil(tok) {
+		return "", nil
+	}
+	return "", movieSexprTypeError(tok, typ)
+}
+
+// movieSexprList reports whether tok begins a list, rather than being
+// the symbol nil.
+func movieSexprList(tok sexpr.Token, typ string) (bool, error) {
+	if _, ok := tok.(sexpr.StartList); ok {
+		return true, nil
+	} else if movieSexprIsNil(tok) {
+		return false, nil
+	}
+	return false, movieSexprTypeError(tok, typ)
+}
+
+// movieSexprStart reads the start of a (key value) pair.
+func movieSexprStart(dec *sexpr.Decoder) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if _, ok := tok.(sexpr.StartList); !ok {
+		return fmt.Errorf("sexpr: got %v, want (key value)", tok)
+	}
+	return nil
+}
+
+// movieSexprEnd reads the end of a list.
+func movieSexprEnd(dec *sexpr.Decoder) error {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	if _, ok := tok.(sexpr.EndList); !ok {
+		return fmt.Errorf("sexpr: got %v, want )", tok)
+	}
+	return nil
+}
+
+// movieSexprField reads the start of a (name value) pair of a struct, and
+// returns the index in names of the field that name matches, as
+// sexpr.Unmarshal would match it, or -1.
+func movieSexprField(dec *sexpr.Decoder, names []string) (int, error) {
+	if err := movieSexprStart(dec); err != nil {
+		return 0, err
+	}
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, err
+	}
+	name, ok := tok.(sexpr.Symbol)
+	if !ok {
+		return 0, fmt.Errorf("sexpr: got %v, want field name", tok)
+	}
+	for i, s := range names {
+		if s == string(name) {
+			return i, nil
+		}
+	}
+	undashed := strings.Replace(string(name), "-", "", -1)
+	for i, s := range names {
+		if strings.EqualFold(s, string(name)) || strings.EqualFold(s, undashed) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
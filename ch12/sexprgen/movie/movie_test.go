@@ -0,0 +1,175 @@
+package movie
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"gopl.io/ch12/sexpr"
+)
+
+// The plain types have the fields of the generated ones but none of
+// their methods, so package sexpr encodes them by reflection.
+type (
+	plainMovie  Movie
+	plainReview Review
+)
+
+var sequel = "Dr. Strangelove II"
+
+var strangelove = Movie{
+	Title:    "Dr. Strangelove",
+	Subtitle: "How I Learned to Stop Worrying and Love the Bomb",
+	Year:     1964,
+	Actor: map[string]string{
+		"Dr. Strangelove":            "Peter Sellers",
+		"Grp. Capt. Lionel Mandrake": "Peter Sellers",
+		"Pres. Merkin Muffley":       "Peter Sellers",
+		"Gen. Buck Turgidson":        "George C. Scott",
+		"Brig. Gen. Jack D. Ripper":  "Sterling Hayden",
+		`Maj. T.J. "King" Kong`:      "Slim Pickens",
+	},
+	Oscars: []string{
+		"Best Actor (Nomin.)",
+		"Best Adapted Screenplay (Nomin.)",
+		"Best Director (Nomin.)",
+		"Best Picture (Nomin.)",
+	},
+	Sequel: &sequel,
+}
+
+var review = Review{
+	Film:    &strangelove,
+	Critic:  "Pauline Kael",
+	Stars:   5,
+	Weights: map[int][]float64{10: {0.5}, -2: {1e21, -0.25}, 3: nil},
+	Best:    [2]string{"Peter Sellers", "é"},
+	Watched: true,
+	Rating:  -3,
+	Runtime: 95 * time.Minute,
+	Note:    []int{1, 2},
+	Related: []Movie{{Title: "Fail Safe", Year: 1964}},
+}
+
+func init() { sexpr.Register([]int(nil)) }
+
+func TestMarshal(t *testing.T) {
+	for _, test := range []struct {
+		generated sexpr.Marshaler
+		plain     interface{}
+	}{
+		{strangelove, plainMovie(strangelove)},
+		{Movie{}, plainMovie{}},
+		{review, plainReview(review)},
+		{Review{Internal: "x", private: 1}, plainReview{Internal: "x", private: 1}},
+	} {
+		want, err := sexpr.Marshal(test.plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := test.generated.MarshalSexpr()
+		if err != nil {
+			t.Errorf("MarshalSexpr(%+v): %v", test.generated, err)
+			continue
+		}
+		if string(got) != string(want) {
+			t.Errorf("MarshalSexpr(%+v) =\n%s\nwant\n%s", test.generated, got, want)
+		}
+	}
+
+	if _, err := (Review{Score: float32(math.Inf(1))}).MarshalSexpr(); err == nil {
+		t.Errorf("MarshalSexpr(+Inf) succeeded, want error")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	for _, input := range []string{
+		`((Title "Dr. Strangelove") (Year 1964) (Sequel "II"))`,
+		`((title "x") (actor (("a" "b"))) (oscars nil) (sequel nil) (Extra (1 2)))`,
+		`((by "Pauline Kael") (STARS 5) (best ("a" "b")) (Rating -128) (watched t))`,
+		`((Film ((Title "x"))) (Weights ((1 (2 3.5)) (-1 ()))) (Runtime "1h35m"))`,
+		`((Related (((Title "a")) nil)) (Note ("[]int" (1 2))) (Film nil))`,
+		`((Stars 256))`,
+		`((Rating 128))`,
+		`((Best ("a" "b" "c")))`,
+		`((Score 1e39))`,
+		`((Watched 1))`,
+		`((by by))`,
+		`((Weights ((1))))`,
+		`((Film #1=((Title "x"))))`,
+		`((Film #1=((Title "x"))) (Related (((Sequel #2="y")) ((Sequel #2#)))))`,
+		`((Film #1#))`,
+		`((Best #1=("a" "b")))`,
+		`((Film ((Title "x"))`,
+		`((Film) 1)`,
+		`() ()`,
+	} {
+		var got Review
+		gotErr := got.UnmarshalSexpr([]byte(input))
+		var want plainReview
+		wantErr := sexpr.Unmarshal([]byte(input), &want)
+		if (gotErr == nil) != (wantErr == nil) {
+			t.Errorf("UnmarshalSexpr(%s) = %v, want error %v", input, gotErr, wantErr)
+		} else if gotErr == nil && !reflect.DeepEqual(got, Review(want)) {
+			t.Errorf("UnmarshalSexpr(%s) = %+v, want %+v", input, got, want)
+		}
+	}
+
+	// Generated values read back what they write. (Nil slices and
+	// maps read back as empty ones, so compare the encodings.)
+	data, err := review.MarshalSexpr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Review
+	if err := got.UnmarshalSexpr(data); err != nil {
+		t.Fatalf("UnmarshalSexpr(%s): %v", data, err)
+	}
+	if again, err := got.MarshalSexpr(); err != nil || string(again) != string(data) {
+		t.Errorf("UnmarshalSexpr(%s) = %+v, which encodes as %s, %v", data, got, again, err)
+	}
+}
+
+func BenchmarkMarshal(b *testing.B) {
+	b.Run("reflect", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sexpr.Marshal(plainMovie(strangelove))
+		}
+	})
+	b.Run("generated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			strangelove.MarshalSexpr()
+		}
+	})
+}
+
+func BenchmarkUnmarshal(b *testing.B) {
+	data, _ := strangelove.MarshalSexpr()
+	b.Run("reflect", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var m plainMovie
+			sexpr.Unmarshal(data, &m)
+		}
+	})
+	b.Run("generated", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var m Movie
+			m.UnmarshalSexpr(data)
+		}
+	})
+}
+
+/*
+$ go test -bench=. -benchmem gopl.io/ch12/sexprgen/movie
+goos: linux
+goarch: amd64
+pkg: gopl.io/ch12/sexprgen/movie
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkMarshal/reflect         	   39778	     32860 ns/op	    5456 B/op	      99 allocs/op
+BenchmarkMarshal/generated       	  112106	     10537 ns/op	    2640 B/op	      20 allocs/op
+BenchmarkUnmarshal/reflect       	   40959	     35052 ns/op	    6408 B/op	     115 allocs/op
+BenchmarkUnmarshal/generated     	   74811	     15752 ns/op	    3072 B/op	      65 allocs/op
+PASS
+ok  	gopl.io/ch12/sexprgen/movie	5.990s
+*/
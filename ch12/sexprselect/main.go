@@ -0,0 +1,54 @@
+// Sexprselect prints the values selected by a query from each
+// S-expression read from the standard input, with their paths.
+// See gopl.io/ch12/sexpr.Select for the form of queries.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopl.io/ch12/sexpr"
+)
+
+func main() {
+	query := strings.Join(os.Args[1:], " ")
+	dec := sexpr.NewDecoder(os.Stdin)
+	for {
+		var doc sexpr.Value
+		if err := dec.Decode(&doc); err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "sexprselect: %v\n", err)
+			os.Exit(1)
+		}
+		matches, err := sexpr.Select(doc, query)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "sexprselect: %v\n", err)
+			os.Exit(2)
+		}
+		for _, m := range matches {
+			fmt.Println(m)
+		}
+	}
+}
+
+/*
+Run:
+$ go build gopl.io/ch12/sexprselect
+$ cat movie.sexpr
+((Title "Dr. Strangelove") (Year 1964)
+ (Actor (("Dr. Strangelove" "Peter Sellers") ("Gen. Buck Turgidson" "George C. Scott")))
+ (Oscars ("Best Actor (Nomin.)" "Best Adapted Screenplay (Nomin.)" "Best Director (Nomin.)")))
+
+$ ./sexprselect '(Actor *)' < movie.sexpr
+Actor["Dr. Strangelove"]: "Peter Sellers"
+Actor["Gen. Buck Turgidson"]: "George C. Scott"
+
+$ ./sexprselect 'Oscars[2]' < movie.sexpr
+Oscars[2]: "Best Director (Nomin.)"
+
+$ ./sexprselect '** Title' < movie.sexpr
+Title: "Dr. Strangelove"
+*/
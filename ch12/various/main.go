@@ -257,9 +257,9 @@ func displayExample() {
 	// (*&i).type = int
 	// (*&i).value = 3
 
-	// As currently implemented, `Display` will never terminate if it encounters
-	// a cycle in the object graph, such as this linked list that eats its own
-	// tail:
+	// As implemented in the book, `Display` would never terminate if it
+	// encountered a cycle in the object graph, such as this linked list that
+	// eats its own tail:
 	// a struct that points to itself
 	type Cycle struct {
 		Value int
@@ -267,8 +267,8 @@ func displayExample() {
 	}
 	var c Cycle
 	c = Cycle{42, &c}
-	// display.Display("c", c)
-	// Display prints this ever-growing expansion:
+	display.Display("c", c)
+	// It would print this ever-growing expansion:
 	//
 	// Display c (display.Cycle):
 	// c.Value = 42
@@ -276,6 +276,14 @@ func displayExample() {
 	// (*(*c.Tail).Tail).Value = 42
 	// (*(*(*c.Tail).Tail).Tail).Value = 42
 	// ...ad infinitum...
+	//
+	// Our `Display` remembers the pointers it has followed, and prints a
+	// pointer seen before as the path at which it was first found:
+	//
+	// Display c (display.Cycle):
+	// c.Value = 42
+	// (*c.Tail).Value = 42
+	// (*c.Tail).Tail = c.Tail
 }
 
 func settingVariablesWithReflectValue() {
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// A tileCache is a concurrency-safe cache of the tiles returned by
+// render for each key. Like memo.Memo (see gopl.io/ch9/memo5), it calls
+// render once for a key however many requests for it arrive together,
+// but it holds at most max tiles, evicting the least recently used,
+// and it forgets a key whose render fails so that it may be retried.
+// A render is cancelled when the request that started it is; other
+// requests waiting for the same key then retry it.
+type tileCache struct {
+	render func(key string, done <-chan struct{}) (renderedTile, error)
+	max    int
+
+	mu      sync.Mutex
+	lru     *list.List // of *cacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key   string
+	tile  renderedTile
+	err   error
+	ready chan struct{} // closed when tile and err are set
+}
+
+func newTileCache(max int, render func(key string, done <-chan struct{}) (renderedTile, error)) *tileCache {
+	return &tileCache{
+		render:  render,
+		max:     max,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the tile for key, rendering it if it is not cached.
+// It gives up with errCancelled once done is closed.
+func (c *tileCache) Get(key string, done <-chan struct{}) (renderedTile, error) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		// This is a repeat request for key.
+		c.lru.MoveToFront(el)
+		e := el.Value.(*cacheEntry)
+		c.mu.Unlock()
+		select {
+		case <-e.ready: // wait for the render to finish
+		case <-done:
+			return renderedTile{}, errCancelled
+		}
+		if e.err == errCancelled {
+			// The request that rendered key went away; render it anew.
+			return c.Get(key, done)
+		}
+		return e.tile, e.err
+	}
+	// This is the first request for key. This goroutine becomes
+	// responsible for rendering the tile and broadcasting the ready
+	// condition. An evicted entry may still be awaited by others.
+	e := &cacheEntry{key: key, ready: make(chan struct{})}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.max {
+		c.remove(c.lru.Back())
+	}
+	c.mu.Unlock()
+
+	e.tile, e.err = c.render(key, done)
+	if e.err != nil {
+		// Forget e before waking those who wait for it,
+		// so that their retries do not find it.
+		c.mu.Lock()
+		if el, ok := c.entries[key]; ok && el.Value == e {
+			c.remove(el)
+		}
+		c.mu.Unlock()
+	}
+	close(e.ready)
+	return e.tile, e.err
+}
+
+// remove removes the entry el. c.mu must be held.
+func (c *tileCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*cacheEntry).key)
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A gradient is a sequence of evenly spaced color stops.
+type gradient []color.RGBA
+
+// at returns the color at position t in [0, 1] along g.
+func (g gradient) at(t float64) color.RGBA {
+	if len(g) == 1 {
+		return g[0]
+	}
+	t = math.Max(0, math.Min(1, t)) * float64(len(g)-1)
+	i := int(t)
+	if i == len(g)-1 {
+		return g[i]
+	}
+	f := t - float64(i)
+	mix := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + (float64(b)-float64(a))*f))
+	}
+	a, b := g[i], g[i+1]
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// palettes are the named gradients. Position 0 is the color of points
+// that escape at once.
+var palettes = map[string]gradient{
+	"gray":    {{255, 255, 255, 255}, {0, 0, 0, 255}},
+	"fire":    {{0, 0, 0, 255}, {128, 0, 0, 255}, {255, 96, 0, 255}, {255, 224, 64, 255}, {255, 255, 255, 255}},
+	"ocean":   {{0, 8, 32, 255}, {0, 64, 160, 255}, {0, 192, 255, 255}, {224, 255, 255, 255}},
+	"rainbow": {{255, 0, 0, 255}, {255, 255, 0, 255}, {0, 255, 0, 255}, {0, 255, 255, 255}, {0, 0, 255, 255}, {255, 0, 255, 255}, {255, 0, 0, 255}},
+}
+
+// parsePalette returns the gradient named s, or, if s is a
+// comma-separated list of two or more RRGGBB colors, the gradient
+// through those colors.
+func parsePalette(s string) (gradient, error) {
+	if g, ok := palettes[s]; ok {
+		return g, nil
+	}
+	stops := strings.Split(s, ",")
+	if len(stops) < 2 {
+		var names []string
+		for name := range palettes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown palette %q; want one of %v or a list of RRGGBB colors", s, names)
+	}
+	var g gradient
+	for _, stop := range stops {
+		stop = strings.TrimPrefix(strings.TrimSpace(stop), "#")
+		rgb, err := strconv.ParseUint(stop, 16, 32)
+		if err != nil || len(stop) != 6 {
+			return nil, fmt.Errorf("bad color %q in palette; want RRGGBB", stop)
+		}
+		g = append(g, color.RGBA{uint8(rgb >> 16), uint8(rgb >> 8), uint8(rgb), 255})
+	}
+	return g, nil
+}
+
+// rootColors are the hues of the basins of the roots of z⁴ - 1.
+var rootColors = [...]color.RGBA{
+	{255, 64, 64, 255},
+	{64, 255, 64, 255},
+	{64, 64, 255, 255},
+	{255, 255, 64, 255},
+}
+
+// count returns the iteration count of an escaped sample, or with
+// smooth coloring, its normalized iteration count
+//
+//	n + 1 - log(log|z|)/log(d)
+//
+// which varies continuously across the bands of equal n.
+func count(s sample, cfg config) float64 {
+	if !cfg.smooth || s.root > 0 {
+		return float64(s.n)
+	}
+	d := 2.0
+	if cfg.family == "multibrot" {
+		d = float64(cfg.exponent)
+	}
+	nu := float64(s.n) + 1 - math.Log(math.Log(s.abs))/math.Log(d)
+	return math.Max(nu, 0)
+}
+
+// colorize returns a width×height image of the samples of a
+// (width·ss)×(height·ss) image, where ss is the supersampling factor
+// of cfg; each pixel is the mean of ss×ss samples.
+//
+// Each escaped sample is placed along the palette gradient by its
+// count: with histogram equalization, by the fraction of samples with
+// lower counts; otherwise by its count times the contrast, cycling
+// every 256 levels. Samples in a Newton basin take the hue of its
+// root, darkened by the luminance of the palette at their position.
+func colorize(samples []sample, width, height int, cfg config) *image.RGBA {
+	pal, _ := parsePalette(cfg.palette) // checked by parseConfig
+	ss := cfg.supersample
+
+	counts := make([]float64, len(samples))
+	var escaped []float64
+	for i, s := range samples {
+		if s.n >= 0 {
+			counts[i] = count(s, cfg)
+			escaped = append(escaped, counts[i])
+		}
+	}
+	position := func(c float64) float64 {
+		return math.Mod(float64(cfg.contrast)*c, 256) / 255
+	}
+	if cfg.equalize {
+		sort.Float64s(escaped)
+		position = func(c float64) float64 {
+			return float64(sort.SearchFloat64s(escaped, c)) / float64(len(escaped))
+		}
+	}
+	shade := func(s sample, c float64) color.RGBA {
+		if s.n < 0 {
+			return color.RGBA{0, 0, 0, 255}
+		}
+		col := pal.at(position(c))
+		if s.root == 0 {
+			return col
+		}
+		y := color.GrayModel.Convert(col).(color.Gray).Y
+		scale := func(v uint8) uint8 { return uint8(int(v) * int(y) / 255) }
+		r := rootColors[s.root-1]
+		return color.RGBA{scale(r.R), scale(r.G), scale(r.B), 255}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for py := 0; py < height; py++ {
+		for px := 0; px < width; px++ {
+			var r, g, b int
+			for sy := py * ss; sy < (py+1)*ss; sy++ {
+				for sx := px * ss; sx < (px+1)*ss; sx++ {
+					i := sy*width*ss + sx
+					c := shade(samples[i], counts[i])
+					r, g, b = r+int(c.R), g+int(c.G), b+int(c.B)
+				}
+			}
+			n := ss * ss
+			mean := func(sum int) uint8 { return uint8((sum + n/2) / n) }
+			img.SetRGBA(px, py, color.RGBA{mean(r), mean(g), mean(b), 255})
+		}
+	}
+	return img
+}
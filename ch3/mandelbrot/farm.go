@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// The render farm splits a large image into bands of rows. Workers
+// connect to the coordinator over TCP and are sent one band at a time
+// as a job; each replies with the band's pixels. If a worker drops or
+// times out, its band is handed to another worker. If a worker cannot
+// render a band at all, as when the config is bad, the farm fails:
+// every worker would fail the same way.
+
+// A job asks a worker to render rows [Y0, Y1) of an image Width
+// pixels wide of the square of side 4/2^Zoom centered on the view
+// center.
+type job struct {
+	Band   int
+	Width  int
+	Y0, Y1 int
+	Zoom   int
+	Config string // query string of the config; see parseConfig
+}
+
+// A result holds the RGBA pixels of the band rendered for a job, or
+// the error that prevented it.
+type result struct {
+	Band int
+	Pix  []byte
+	Err  string
+}
+
+// band returns the rect whose image of the given width begins at row
+// y0 of the image of r.
+func (r rect) band(y0, width int) rect {
+	prec := r.y.Prec() + 64
+	y := new(big.Float).SetPrec(prec).SetInt64(int64(y0))
+	y.Mul(y, r.size)
+	y.Quo(y, new(big.Float).SetInt64(int64(width)))
+	y.Add(y, r.y)
+	return rect{r.x, y, r.size}
+}
+
+// renderJob renders the band described by j.
+func renderJob(j job) (*image.RGBA, error) {
+	q, err := url.ParseQuery(j.Config)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(q, defaults)
+	if err != nil {
+		return nil, err
+	}
+	r := centerRect(cfg.x, cfg.y, j.Zoom).band(j.Y0, j.Width)
+	img, _, err := render(nil, j.Width, j.Y1-j.Y0, r, cfg)
+	return img, err
+}
+
+// work renders the jobs sent by the coordinator on conn until the
+// coordinator closes it.
+func work(conn net.Conn) error {
+	defer conn.Close()
+	dec := gob.NewDecoder(conn)
+	enc := gob.NewEncoder(conn)
+	for {
+		var j job
+		if err := dec.Decode(&j); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		img, err := renderJob(j)
+		if err != nil {
+			err = fmt.Errorf("band %d: %v", j.Band, err)
+			enc.Encode(result{Band: j.Band, Err: err.Error()})
+			return err
+		}
+		if err := enc.Encode(result{Band: j.Band, Pix: img.Pix}); err != nil {
+			return err
+		}
+	}
+}
+
+// A farm coordinates the rendering of one image by remote workers.
+type farm struct {
+	img     *image.RGBA
+	jobs    []job
+	timeout time.Duration // time allowed for a worker to render a band
+
+	pending chan int // indices of jobs awaiting a worker
+	wg      sync.WaitGroup
+	done    chan struct{} // closed when every band has been rendered
+
+	failOnce sync.Once
+	failed   chan struct{} // closed when a worker reports err
+	err      error
+}
+
+// A renderError is an error reported by a worker that could not
+// render a band, rather than a failure of the worker itself.
+type renderError string
+
+func (e renderError) Error() string { return string(e) }
+
+// newFarm returns a farm for a width×height image of the square of
+// side 4/2^zoom centered on the view center of cfg, split into bands
+// of at most bandHeight rows.
+func newFarm(width, height, bandHeight, zoom int, cfg config, timeout time.Duration) (*farm, error) {
+	if bandHeight < 1 {
+		return nil, fmt.Errorf("band: %d rows; want at least 1", bandHeight)
+	}
+	if cfg.equalize {
+		return nil, fmt.Errorf("histogram equalization needs the whole image; " +
+			"it cannot be used with a render farm")
+	}
+	f := &farm{
+		img:     image.NewRGBA(image.Rect(0, 0, width, height)),
+		timeout: timeout,
+		done:    make(chan struct{}),
+		failed:  make(chan struct{}),
+	}
+	query := cfg.values().Encode()
+	for y0 := 0; y0 < height; y0 += bandHeight {
+		y1 := y0 + bandHeight
+		if y1 > height {
+			y1 = height
+		}
+		f.jobs = append(f.jobs, job{
+			Band:   len(f.jobs),
+			Width:  width,
+			Y0:     y0,
+			Y1:     y1,
+			Zoom:   zoom,
+			Config: query,
+		})
+	}
+	f.pending = make(chan int, len(f.jobs))
+	for i := range f.jobs {
+		f.pending <- i
+	}
+	f.wg.Add(len(f.jobs))
+	go func() {
+		f.wg.Wait()
+		close(f.done)
+	}()
+	return f, nil
+}
+
+// run accepts workers on ln until every band has been rendered,
+// then returns the stitched image. It returns the first error reported
+// by a worker that could not render a band.
+func (f *farm) run(ln net.Listener) (*image.RGBA, error) {
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return // listener closed
+			}
+			go f.serve(conn)
+		}
+	}()
+	defer ln.Close()
+	select {
+	case <-f.done:
+		return f.img, nil
+	case <-f.failed:
+		return nil, f.err
+	}
+}
+
+// fail ends the run with err, if it has not already ended.
+func (f *farm) fail(err error) {
+	f.failOnce.Do(func() {
+		f.err = err
+		close(f.failed)
+	})
+}
+
+// serve hands bands to the worker on conn, one at a time, until every
+// band has been rendered or the worker fails.
+func (f *farm) serve(conn net.Conn) {
+	defer conn.Close()
+	who := conn.RemoteAddr()
+	log.Printf("farm: worker %s connected", who)
+	enc := gob.NewEncoder(conn)
+	dec := gob.NewDecoder(conn)
+	for {
+		var i int
+		select {
+		case <-f.done:
+			return
+		case <-f.failed:
+			return
+		case i = <-f.pending:
+		}
+		err := f.assign(enc, dec, conn, f.jobs[i])
+		if _, ok := err.(renderError); ok {
+			log.Printf("farm: worker %s failed band %d: %v", who, i, err)
+			f.fail(err)
+			return
+		} else if err != nil {
+			log.Printf("farm: worker %s dropped band %d: %v", who, i, err)
+			f.pending <- i // reassign
+			return
+		}
+		log.Printf("farm: worker %s rendered band %d", who, i)
+		f.wg.Done()
+	}
+}
+
+// assign sends j to a worker and copies the pixels it returns into
+// the image.
+func (f *farm) assign(enc *gob.Encoder, dec *gob.Decoder, conn net.Conn, j job) error {
+	conn.SetDeadline(time.Now().Add(f.timeout))
+	if err := enc.Encode(j); err != nil {
+		return err
+	}
+	var res result
+	if err := dec.Decode(&res); err != nil {
+		return err
+	}
+	if res.Err != "" {
+		return renderError(res.Err)
+	}
+	rows := f.img.Pix[j.Y0*f.img.Stride : j.Y1*f.img.Stride]
+	if res.Band != j.Band || len(res.Pix) != len(rows) {
+		return fmt.Errorf("got band %d with %d bytes, want band %d with %d bytes",
+			res.Band, len(res.Pix), j.Band, len(rows))
+	}
+	copy(rows, res.Pix)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+// A sample is the result of iterating the point at one pixel.
+type sample struct {
+	n    int     // iterations until the point escaped or converged, or -1
+	abs  float64 // the magnitude of the point's orbit once it escaped
+	root int     // for Newton basins, 1 + the index of the root reached
+}
+
+var bounded = sample{n: -1}
+
+// A family computes the sample of the point z in a kind of fractal.
+type family func(z complex128, cfg config) sample
+
+// families maps each value of the family parameter to its function.
+var families = map[string]family{
+	"mandelbrot":  mandelbrot,
+	"julia":       julia,
+	"multibrot":   multibrot,
+	"burningship": burningShip,
+	"newton":      newton,
+}
+
+// familyNames returns the names of the families, in sorted order.
+func familyNames() []string {
+	var names []string
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mandelbrot iterates v = v² + z from v = 0.
+func mandelbrot(z complex128, cfg config) sample {
+	var v complex128
+	for n := 0; n < cfg.iterations; n++ {
+		v = v*v + z
+		if abs := cmplx.Abs(v); abs > cfg.bailout() {
+			return sample{n: n, abs: abs}
+		}
+	}
+	return bounded
+}
+
+// julia iterates v = v² + c from v = z, for the constant c of cfg.
+func julia(z complex128, cfg config) sample {
+	c := complex(cfg.cr, cfg.ci)
+	v := z
+	for n := 0; n < cfg.iterations; n++ {
+		v = v*v + c
+		if abs := cmplx.Abs(v); abs > cfg.bailout() {
+			return sample{n: n, abs: abs}
+		}
+	}
+	return bounded
+}
+
+// multibrot iterates v = v^d + z from v = 0, for the exponent d of cfg.
+func multibrot(z complex128, cfg config) sample {
+	var v complex128
+	for n := 0; n < cfg.iterations; n++ {
+		p := v
+		for i := 1; i < cfg.exponent; i++ {
+			p *= v
+		}
+		v = p + z
+		if abs := cmplx.Abs(v); abs > cfg.bailout() {
+			return sample{n: n, abs: abs}
+		}
+	}
+	return bounded
+}
+
+// burningShip iterates v = (|Re v| + i|Im v|)² + z from v = 0.
+func burningShip(z complex128, cfg config) sample {
+	var v complex128
+	for n := 0; n < cfg.iterations; n++ {
+		v = complex(math.Abs(real(v)), math.Abs(imag(v)))
+		v = v*v + z
+		if abs := cmplx.Abs(v); abs > cfg.bailout() {
+			return sample{n: n, abs: abs}
+		}
+	}
+	return bounded
+}
+
+// roots are the roots of z⁴ - 1.
+var roots = [...]complex128{1, 1i, -1, -1i}
+
+// newton applies Newton's method to z⁴ - 1 from z, and reports which
+// root it converges to.
+func newton(z complex128, cfg config) sample {
+	const eps = 1e-6
+	for n := 0; n < cfg.iterations; n++ {
+		z3 := z * z * z
+		z -= (z3*z - 1) / (4 * z3)
+		for i, r := range roots {
+			if cmplx.Abs(z-r) < eps {
+				return sample{n: n, root: i + 1}
+			}
+		}
+	}
+	return bounded
+}
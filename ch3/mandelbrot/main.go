@@ -1,45 +1,275 @@
-// Mandelbrot emits a PNG image of the Mandelbrot fractal.
+// Mandelbrot emits a PNG image of the Mandelbrot fractal, or, with the
+// -family flag, of a Julia set, Multibrot set, the Burning Ship, or
+// the basins of Newton's method for z⁴ - 1.
+//
+// With the -http flag, it instead serves a zoomable view of the fractal,
+// rendered on demand as 256×256 tiles. With the -farm flag, it renders
+// a large image in bands handed out to -worker processes over TCP.
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"image"
-	"image/color"
 	"image/png"
-	"math/cmplx"
+	"log"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"time"
 )
 
+// A config holds the parameters that control rendering.
+type config struct {
+	x, y       float64 // center of the view
+	iterations int     // iterations before a point is deemed bounded
+	contrast   int     // gray levels per iteration
+	precision  string  // name of the arithmetic backend
+	family     string  // name of the kind of fractal
+	cr, ci     float64 // constant c of the julia family
+	exponent   int     // exponent d of the multibrot family
+
+	smooth      bool   // use normalized iteration counts
+	palette     string // gradient name or list of RRGGBB colors
+	equalize    bool   // spread counts evenly over the palette
+	supersample int    // samples per pixel along each axis
+}
+
+// bailout returns the radius beyond which a point is deemed to escape.
+// Smooth coloring needs a large radius to hide the bands.
+func (cfg config) bailout() float64 {
+	if cfg.smooth {
+		return 256
+	}
+	return 2
+}
+
+const maxIterations = 100000
+
+// maxBigRatIterations bounds the iterations of the bigrat backend,
+// whose numbers double in size with each one: at 12, an interior
+// point takes a tenth of a second; at 16, half a minute.
+const maxBigRatIterations = 12
+
+var defaults = config{
+	iterations: 200,
+	contrast:   15,
+	precision:  "complex128",
+	family:     "mandelbrot",
+	cr:         -0.8,
+	ci:         0.156,
+	exponent:   3,
+
+	palette:     "gray",
+	supersample: 1,
+}
+
+var (
+	httpAddr = flag.String("http", "", "serve a tile viewer on `addr` instead of writing a PNG to stdout")
+	zoom     = flag.Int("zoom", 0, "zoom `level`: the image shows a square of side 4/2^level")
+	size     = flag.Int("size", 1024, "width and height of the image in `pixels`")
+
+	farmAddr   = flag.String("farm", "", "render the image with workers that connect to `addr`")
+	workerAddr = flag.String("worker", "", "render bands for the farm at `addr`")
+	bandRows   = flag.Int("band", 256, "`rows` per band of a farm image")
+	timeout    = flag.Duration("timeout", time.Minute, "time a farm worker may take to render a band")
+)
+
+func init() {
+	flag.Float64Var(&defaults.x, "x", 0, "real part of the view center")
+	flag.Float64Var(&defaults.y, "y", 0, "imaginary part of the view center")
+	flag.IntVar(&defaults.iterations, "iter", defaults.iterations, "maximum `iterations` per point")
+	flag.IntVar(&defaults.contrast, "contrast", defaults.contrast, "gray levels per iteration")
+	flag.StringVar(&defaults.precision, "precision", defaults.precision,
+		"arithmetic `backend`: complex64, complex128, bigfloat, bigrat or perturb")
+	flag.StringVar(&defaults.family, "family", defaults.family,
+		"`fractal`: mandelbrot, julia, multibrot, burningship or newton")
+	flag.Float64Var(&defaults.cr, "cr", defaults.cr, "real part of the julia constant c")
+	flag.Float64Var(&defaults.ci, "ci", defaults.ci, "imaginary part of the julia constant c")
+	flag.IntVar(&defaults.exponent, "d", defaults.exponent, "`exponent` of the multibrot family")
+	flag.BoolVar(&defaults.smooth, "smooth", false, "color by normalized iteration count")
+	flag.StringVar(&defaults.palette, "palette", defaults.palette,
+		"`gradient`: gray, fire, ocean, rainbow, or a comma-separated list of RRGGBB colors")
+	flag.BoolVar(&defaults.equalize, "equalize", false, "equalize the histogram of counts")
+	flag.IntVar(&defaults.supersample, "ss", defaults.supersample, "supersample each pixel `n`×n times")
+}
+
 func main() {
-	const (
-		xmin, ymin, xmax, ymax = -2, -2, +2, +2
-		width, height          = 1024, 1024
-	)
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	for py := 0; py < height; py++ {
-		y := float64(py)/height*(ymax-ymin) + ymin
-		for px := 0; px < width; px++ {
-			x := float64(px)/width*(xmax-xmin) + xmin
-			z := complex(x, y)
-			// Image point (px, py) represents complex value z.
-			img.Set(px, py, mandelbrot(z))
+	flag.Parse()
+	if *size < 1 {
+		fmt.Fprintf(os.Stderr, "mandelbrot: size: %d pixels; want at least 1\n", *size)
+		os.Exit(2)
+	}
+	cfg, err := parseConfig(nil, defaults)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch {
+	case *httpAddr != "":
+		log.Fatal(serve(*httpAddr, cfg))
+
+	case *workerAddr != "":
+		conn, err := net.Dial("tcp", *workerAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := work(conn); err != nil {
+			log.Fatal(err)
+		}
+
+	case *farmAddr != "":
+		ln, err := net.Listen("tcp", *farmAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f, err := newFarm(*size, *size, *bandRows, *zoom, cfg, *timeout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		start := time.Now()
+		log.Printf("farm: waiting for workers on %s", ln.Addr())
+		img, err := f.run(ln)
+		if err != nil {
+			log.Fatal(err)
 		}
+		log.Printf("farm: rendered %dx%d in %v", *size, *size, time.Since(start))
+		if err := png.Encode(os.Stdout, img); err != nil {
+			log.Fatal(err)
+		}
+
+	default:
+		r := centerRect(cfg.x, cfg.y, *zoom)
+		img, elapsed, _ := render(nil, *size, *size, r, cfg)
+		log.Printf("%s: rendered %dx%d in %v", cfg.precision, *size, *size, elapsed)
+		png.Encode(os.Stdout, img) // NOTE: ignoring errors
 	}
-	png.Encode(os.Stdout, img) // NOTE: ignoring errors
 }
 
-func mandelbrot(z complex128) color.Color {
-	const iterations = 200
-	const contrast = 15
+// errCancelled is returned by render when done is closed before it
+// has finished.
+var errCancelled = errors.New("render cancelled")
+
+// render returns a width×height image of r, and the time the backend
+// took to compute it. If done is closed first, it gives up and returns
+// errCancelled.
+func render(done <-chan struct{}, width, height int, r rect, cfg config) (*image.RGBA, time.Duration, error) {
+	ss := cfg.supersample
+	start := time.Now()
+	samples := make([]sample, width*ss*height*ss)
+	backends[cfg.precision](done, samples, width*ss, height*ss, r, cfg)
+	elapsed := time.Since(start)
+	if cancelled(done) {
+		return nil, elapsed, errCancelled
+	}
+	return colorize(samples, width, height, cfg), elapsed, nil
+}
 
-	var v complex128
-	for n := uint8(0); n < iterations; n++ {
-		v = v*v + z
-		if cmplx.Abs(v) > 2 {
-			return color.Gray{255 - contrast*n}
+// parseConfig returns a copy of cfg with the fields named in q replaced.
+func parseConfig(q url.Values, cfg config) (config, error) {
+	for name, p := range map[string]*float64{
+		"x": &cfg.x, "y": &cfg.y, "cr": &cfg.cr, "ci": &cfg.ci,
+	} {
+		if s := q.Get(name); s != "" {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %v", name, err)
+			}
+			*p = f
+		}
+	}
+	for name, p := range map[string]*int{
+		"iter": &cfg.iterations, "contrast": &cfg.contrast, "d": &cfg.exponent,
+		"ss": &cfg.supersample,
+	} {
+		if s := q.Get(name); s != "" {
+			i, err := strconv.Atoi(s)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %v", name, err)
+			}
+			*p = i
+		}
+	}
+	for name, p := range map[string]*bool{"smooth": &cfg.smooth, "equalize": &cfg.equalize} {
+		if s := q.Get(name); s != "" {
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return cfg, fmt.Errorf("%s: %v", name, err)
+			}
+			*p = b
 		}
 	}
-	return color.Black
+	if s := q.Get("precision"); s != "" {
+		cfg.precision = s
+	}
+	if s := q.Get("palette"); s != "" {
+		cfg.palette = s
+	}
+	if s := q.Get("family"); s != "" {
+		cfg.family = s
+	}
+	if _, ok := backends[cfg.precision]; !ok {
+		return cfg, fmt.Errorf("precision: unknown backend %q; want one of %v",
+			cfg.precision, precisions())
+	}
+	if _, ok := families[cfg.family]; !ok {
+		return cfg, fmt.Errorf("family: unknown fractal %q; want one of %v",
+			cfg.family, familyNames())
+	}
+	if cfg.family != "mandelbrot" && cfg.precision != "complex128" {
+		return cfg, fmt.Errorf("family: %s requires complex128 precision", cfg.family)
+	}
+	if cfg.exponent < 2 || cfg.exponent > 16 {
+		return cfg, fmt.Errorf("d: %d out of range [2, 16]", cfg.exponent)
+	}
+	if _, err := parsePalette(cfg.palette); err != nil {
+		return cfg, fmt.Errorf("palette: %v", err)
+	}
+	if cfg.supersample < 1 || cfg.supersample > 8 {
+		return cfg, fmt.Errorf("ss: %d out of range [1, 8]", cfg.supersample)
+	}
+	if cfg.iterations < 1 || cfg.iterations > maxIterations {
+		return cfg, fmt.Errorf("iter: %d out of range [1, %d]", cfg.iterations, maxIterations)
+	}
+	if cfg.precision == "bigrat" && cfg.iterations > maxBigRatIterations {
+		return cfg, fmt.Errorf("iter: %d too many for bigrat precision; want at most %d",
+			cfg.iterations, maxBigRatIterations)
+	}
+	return cfg, nil
+}
+
+// values is the inverse of parseConfig.
+func (cfg config) values() url.Values {
+	return url.Values{
+		"x":         {strconv.FormatFloat(cfg.x, 'g', -1, 64)},
+		"y":         {strconv.FormatFloat(cfg.y, 'g', -1, 64)},
+		"iter":      {strconv.Itoa(cfg.iterations)},
+		"contrast":  {strconv.Itoa(cfg.contrast)},
+		"precision": {cfg.precision},
+		"family":    {cfg.family},
+		"cr":        {strconv.FormatFloat(cfg.cr, 'g', -1, 64)},
+		"ci":        {strconv.FormatFloat(cfg.ci, 'g', -1, 64)},
+		"d":         {strconv.Itoa(cfg.exponent)},
+		"smooth":    {strconv.FormatBool(cfg.smooth)},
+		"palette":   {cfg.palette},
+		"equalize":  {strconv.FormatBool(cfg.equalize)},
+		"ss":        {strconv.Itoa(cfg.supersample)},
+	}
 }
 
 // Run:
 // $ go run gopl.io/ch3/mandelbrot >bin/mandelbrot.png
+// $ go run gopl.io/ch3/mandelbrot -x -0.75 -y 0.1 -iter 500 >bin/mandelbrot.png
+// $ go run gopl.io/ch3/mandelbrot -x -0.7436438870371587 -y 0.13182590420531197 -zoom 44 -iter 3000 -precision perturb >bin/deep.png
+// $ go run gopl.io/ch3/mandelbrot -family julia -cr -0.4 -ci 0.6 >bin/julia.png
+// $ go run gopl.io/ch3/mandelbrot -family burningship -x -0.5 -y -0.5 >bin/ship.png
+// $ go run gopl.io/ch3/mandelbrot -family newton -contrast 8 >bin/newton.png
+// $ go run gopl.io/ch3/mandelbrot -smooth -palette fire -ss 3 >bin/smooth.png
+// $ go run gopl.io/ch3/mandelbrot -equalize -palette 000020,2040ff,ffffff -x -0.75 -y 0.1 -zoom 6 >bin/equalized.png
+// $ go run gopl.io/ch3/mandelbrot -http localhost:8000
+//
+// Render farm, with three workers on the local machine:
+// $ go build gopl.io/ch3/mandelbrot
+// $ ./mandelbrot -farm localhost:8001 -size 16384 -smooth -palette fire >bin/big.png &
+// $ for i in 1 2 3; do ./mandelbrot -worker localhost:8001 & done
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTileKey(t *testing.T) {
+	cfg := defaults
+	cfg.x, cfg.y, cfg.iterations, cfg.contrast = -0.75, 0.1, 500, 7
+	cfg.family, cfg.cr, cfg.ci = "julia", -0.4, 0.6
+	key := tileKey(3, -1, 5, cfg)
+	z, x, y, got, err := parseTileKey(key)
+	if err != nil {
+		t.Fatalf("parseTileKey(%q): %v", key, err)
+	}
+	if z != 3 || x != -1 || y != 5 || got != cfg {
+		t.Errorf("parseTileKey(%q) = %d, %d, %d, %+v", key, z, x, y, got)
+	}
+}
+
+func TestTile(t *testing.T) {
+	s := newTileServer(defaults)
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{"/tile/0/0/0.png", http.StatusOK},
+		{"/tile/2/1/3.png?iter=50&contrast=5", http.StatusOK},
+		{"/tile/0/0/0.png?iter=0", http.StatusBadRequest},
+		{"/tile/0/0/0.png?x=west", http.StatusBadRequest},
+		{"/tile/1/0/1.png?family=newton", http.StatusOK},
+		{"/tile/1/0/1.png?family=julia&cr=0.285&ci=0.01", http.StatusOK},
+		{"/tile/1/0/1.png?family=fern", http.StatusBadRequest},
+		{"/tile/1/0/1.png?family=julia&precision=perturb", http.StatusBadRequest},
+		{"/tile/1/0/1.png?family=multibrot&d=1", http.StatusBadRequest},
+		{"/tile/1/1/1.png?smooth=1&palette=000020,2040ff,ffffff&ss=2", http.StatusOK},
+		{"/tile/1/1/1.png?equalize=true&palette=ocean", http.StatusOK},
+		{"/tile/1/1/1.png?palette=plaid", http.StatusBadRequest},
+		{"/tile/1/1/1.png?ss=100", http.StatusBadRequest},
+		{"/tile/0/0/0.png?precision=bigrat", http.StatusBadRequest},
+		{"/tile/0/0/0.png?precision=bigrat&iter=13", http.StatusBadRequest},
+		{"/tile/3/0/0.png?precision=bigrat&iter=4", http.StatusOK},
+		{"/tile/0/0/0.png?iter=100000&ss=8", http.StatusBadRequest},
+		{"/tile/0/0/0.png?precision=bigfloat&iter=100000&ss=8", http.StatusBadRequest},
+		{"/tile/0/0/0.png?precision=bigfloat&iter=2000", http.StatusBadRequest},
+		{"/tile/0/0/0.png?precision=perturb&iter=100000", http.StatusBadRequest},
+		{"/tile/99/0/0.png", http.StatusBadRequest},
+		{"/tile/0/0.png", http.StatusNotFound},
+	} {
+		rec := httptest.NewRecorder()
+		s.tile(rec, httptest.NewRequest("GET", test.path, nil))
+		if rec.Code != test.status {
+			t.Errorf("GET %s: status %d, want %d", test.path, rec.Code, test.status)
+			continue
+		}
+		if rec.Code != http.StatusOK {
+			continue
+		}
+		img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Errorf("GET %s: %v", test.path, err)
+			continue
+		}
+		if size := img.Bounds().Size(); size.X != tileSize || size.Y != tileSize {
+			t.Errorf("GET %s: tile is %v, want %dx%[3]d", test.path, size, tileSize)
+		}
+	}
+}
+
+// agreement returns the fraction of pixels of a width×width image of
+// r for which the backends named a and b compute the same escape count.
+func agreement(a, b string, width int, r rect, iterations int) float64 {
+	cfg := defaults
+	cfg.iterations = iterations
+	ca := make([]sample, width*width)
+	cb := make([]sample, width*width)
+	backends[a](nil, ca, width, width, r, cfg)
+	backends[b](nil, cb, width, width, r, cfg)
+	same := 0
+	for i := range ca {
+		if ca[i].n == cb[i].n {
+			same++
+		}
+	}
+	return float64(same) / float64(len(ca))
+}
+
+func TestTileCache(t *testing.T) {
+	calls := make(map[string]int)
+	fail := true
+	c := newTileCache(2, func(key string, done <-chan struct{}) (renderedTile, error) {
+		calls[key]++
+		if key == "bad" && fail {
+			return renderedTile{}, fmt.Errorf("bad tile")
+		}
+		return renderedTile{png: []byte(key)}, nil
+	})
+	for _, key := range []string{"a", "b", "a", "c", "a", "b"} {
+		if tile, err := c.Get(key, nil); err != nil || string(tile.png) != key {
+			t.Errorf("Get(%s) = %q, %v", key, tile.png, err)
+		}
+	}
+	// c evicted b, the least recently used, and then b evicted c.
+	if calls["a"] != 1 || calls["b"] != 2 || calls["c"] != 1 {
+		t.Errorf("renders = %v, want a:1 b:2 c:1", calls)
+	}
+
+	// Errors are not cached.
+	if _, err := c.Get("bad", nil); err == nil {
+		t.Errorf("Get(bad) succeeded, want error")
+	}
+	fail = false
+	if _, err := c.Get("bad", nil); err != nil || calls["bad"] != 2 {
+		t.Errorf("Get(bad) after failure = %v after %d renders, want success after 2",
+			err, calls["bad"])
+	}
+}
+
+func TestTileCacheCancel(t *testing.T) {
+	started := make(chan struct{}, 2)
+	c := newTileCache(2, func(key string, done <-chan struct{}) (renderedTile, error) {
+		started <- struct{}{}
+		if done != nil {
+			<-done
+			return renderedTile{}, errCancelled
+		}
+		return renderedTile{png: []byte(key)}, nil
+	})
+	done := make(chan struct{})
+	errc := make(chan error)
+	go func() {
+		_, err := c.Get("a", done)
+		errc <- err
+	}()
+	<-started
+	// A second request for a waits for the first, which is cancelled;
+	// it then renders a itself.
+	tilec := make(chan renderedTile)
+	go func() {
+		tile, _ := c.Get("a", nil)
+		tilec <- tile
+	}()
+	close(done)
+	if err := <-errc; err != errCancelled {
+		t.Errorf("cancelled Get(a) = %v, want %v", err, errCancelled)
+	}
+	if tile := <-tilec; string(tile.png) != "a" {
+		t.Errorf("Get(a) after cancellation = %q, want \"a\"", tile.png)
+	}
+}
+
+func TestTileCancel(t *testing.T) {
+	// This tile would take seconds to render.
+	req := httptest.NewRequest("GET", "/tile/0/0/0.png?iter=100000", nil)
+	ctx, cancel := context.WithCancel(req.Context())
+	cancel()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	newTileServer(defaults).tile(rec, req.WithContext(ctx))
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("cancelled request took %v", d)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("cancelled request got a %d-byte response", rec.Body.Len())
+	}
+}
+
+func TestBackends(t *testing.T) {
+	const width = 32
+	for _, test := range []struct {
+		a, b       string
+		x, y       float64
+		zoom       int
+		iterations int
+		min        float64 // minimum agreement
+	}{
+		{"complex128", "bigfloat", 0, 0, 0, 200, 0.99},
+		{"complex128", "perturb", 0, 0, 0, 200, 0.99},
+		{"complex128", "complex64", 0, 0, 0, 200, 0.95},
+		{"complex128", "bigrat", 0, 0, 0, 8, 1},
+	} {
+		r := centerRect(test.x, test.y, test.zoom)
+		if got := agreement(test.a, test.b, width, r, test.iterations); got < test.min {
+			t.Errorf("%s and %s agree on %.1f%% of pixels at zoom %d, want %.0f%%",
+				test.a, test.b, 100*got, test.zoom, 100*test.min)
+		}
+	}
+}
+
+// At a depth of about 2e-13, complex128 renders seahorse valley as
+// blocky noise, but perturbation theory matches big.Float.
+func TestDeepZoom(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping deep zoom in short mode")
+	}
+	const width, iterations = 16, 3000
+	r := centerRect(-0.7436438870371587, 0.13182590420531197, 44)
+	cfg := defaults
+	cfg.iterations = iterations
+	want := make([]sample, width*width)
+	backends["bigfloat"](nil, want, width, width, r, cfg)
+	for _, test := range []struct {
+		precision string
+		min, max  float64 // bounds on agreement with bigfloat
+	}{
+		{"complex128", 0, 0.9},
+		{"perturb", 0.98, 1},
+	} {
+		got := make([]sample, width*width)
+		backends[test.precision](nil, got, width, width, r, cfg)
+		same := 0
+		for i := range got {
+			if got[i].n == want[i].n {
+				same++
+			}
+		}
+		if f := float64(same) / float64(len(got)); f < test.min || f > test.max {
+			t.Errorf("%s agrees with bigfloat on %.1f%% of pixels, want %.0f%%-%.0f%%",
+				test.precision, 100*f, 100*test.min, 100*test.max)
+		}
+	}
+}
+
+func BenchmarkBackends(b *testing.B) {
+	const width = 64
+	r := centerRect(-0.75, 0.1, 4)
+	samples := make([]sample, width*width)
+	for _, name := range precisions() {
+		cfg := defaults
+		if name == "bigrat" {
+			cfg.iterations = 5 // see renderBigRat
+		}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				backends[name](nil, samples, width, width, r, cfg)
+			}
+		})
+	}
+}
+
+/*
+$ go test -run=NONE -bench=Backends gopl.io/ch3/mandelbrot
+goos: linux
+goarch: amd64
+pkg: gopl.io/ch3/mandelbrot
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkBackends/bigfloat         	       2	 646855644 ns/op
+BenchmarkBackends/bigrat           	       1	1007808284 ns/op
+BenchmarkBackends/complex128       	     188	   6167731 ns/op
+BenchmarkBackends/complex64        	     154	   8108645 ns/op
+BenchmarkBackends/perturb          	     180	   6902794 ns/op
+PASS
+*/
+
+func TestFamilies(t *testing.T) {
+	cfg := defaults
+	cfg.cr, cfg.ci = 0, 0
+	cfg.exponent = 2
+	for _, test := range []struct {
+		family string
+		z      complex128
+		want   sample
+	}{
+		{"mandelbrot", 0, bounded},
+		{"mandelbrot", 1, sample{n: 2}},       // 1, 2, 5
+		{"mandelbrot", -1 - 1i, sample{n: 2}}, // -1-i, -1+i, -1-3i
+		{"multibrot", 1, sample{n: 2}},        // d = 2 is mandelbrot
+		{"julia", 0.5 + 0.5i, bounded},        // |z| < 1 converges to 0 when c = 0
+		{"julia", 1.5, sample{n: 0}},          // 2.25
+		{"burningship", -1 - 1i, bounded},     // -1-i, -1+i, -1+i, ...
+		{"burningship", -1.76 - 0.02i, bounded},
+		{"newton", 2, sample{n: 5, root: 1}},
+		{"newton", -3i, sample{n: 6, root: 4}},
+		{"newton", 0, bounded}, // the derivative vanishes
+	} {
+		got := families[test.family](test.z, cfg)
+		if got.n != test.want.n || got.root != test.want.root {
+			t.Errorf("%s(%v) = %+v, want %+v", test.family, test.z, got, test.want)
+		}
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want int // number of stops, or 0 for an error
+	}{
+		{"gray", 2},
+		{"rainbow", 7},
+		{"000000,ff8000,ffffff", 3},
+		{"#000020, #2040FF", 2},
+		{"plaid", 0},
+		{"ff0000", 0},
+		{"ff0000,00ff0", 0},
+		{"ff0000,00ffzz", 0},
+	} {
+		g, err := parsePalette(test.s)
+		if test.want == 0 {
+			if err == nil {
+				t.Errorf("parsePalette(%q) succeeded, want error", test.s)
+			}
+		} else if err != nil || len(g) != test.want {
+			t.Errorf("parsePalette(%q) = %d stops, %v; want %d stops",
+				test.s, len(g), err, test.want)
+		}
+	}
+}
+
+func TestGradient(t *testing.T) {
+	g, _ := parsePalette("000000,ff8000,ffffff")
+	for _, test := range []struct {
+		t    float64
+		want color.RGBA
+	}{
+		{0, color.RGBA{0, 0, 0, 255}},
+		{0.25, color.RGBA{128, 64, 0, 255}},
+		{0.5, color.RGBA{255, 128, 0, 255}},
+		{1, color.RGBA{255, 255, 255, 255}},
+		{2, color.RGBA{255, 255, 255, 255}},
+	} {
+		if got := g.at(test.t); got != test.want {
+			t.Errorf("at(%g) = %v, want %v", test.t, got, test.want)
+		}
+	}
+}
+
+// distinct returns the number of distinct colors in img.
+func distinct(img image.Image) int {
+	seen := make(map[color.Color]bool)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			seen[img.At(x, y)] = true
+		}
+	}
+	return len(seen)
+}
+
+func TestColoring(t *testing.T) {
+	r := centerRect(-0.75, 0.1, 3)
+	base := defaults
+	base.palette = "fire"
+	img, _, _ := render(nil, 64, 64, r, base)
+	banded := distinct(img)
+
+	// Smooth coloring and supersampling each produce more
+	// intermediate colors than the banded image.
+	for _, change := range []func(*config){
+		func(cfg *config) { cfg.smooth = true },
+		func(cfg *config) { cfg.supersample = 3 },
+		func(cfg *config) { cfg.smooth, cfg.equalize = true, true },
+	} {
+		cfg := base
+		change(&cfg)
+		img, _, _ := render(nil, 64, 64, r, cfg)
+		if n := distinct(img); n <= banded {
+			t.Errorf("%+v: %d colors, want more than %d", cfg, n, banded)
+		}
+		if size := img.Bounds().Size(); size.X != 64 || size.Y != 64 {
+			t.Errorf("%+v: image is %v, want 64x64", cfg, size)
+		}
+	}
+}
+
+// A dropout is a worker that accepts one job and then disconnects.
+func dropout(conn net.Conn) {
+	defer conn.Close()
+	var j job
+	gob.NewDecoder(conn).Decode(&j)
+}
+
+func TestFarm(t *testing.T) {
+	const width, height, bandRows = 128, 100, 16
+	cfg := defaults
+	cfg.x, cfg.y, cfg.palette = -0.5, 0, "rainbow"
+	f, err := newFarm(width, height, bandRows, 1, cfg, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two dropouts connect first, then three good workers.
+	errc := make(chan error, 3)
+	for _, w := range []func(net.Conn){dropout, dropout, nil, nil, nil} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w == nil {
+			go func() { errc <- work(conn) }()
+		} else {
+			go w(conn)
+		}
+	}
+	got, err := f.run(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < cap(errc); i++ {
+		if err := <-errc; err != nil {
+			t.Errorf("worker: %v", err)
+		}
+	}
+
+	// Bands are rendered from their own corners, so a few pixels on
+	// the boundary of the set may differ from a single full render.
+	want, _, _ := render(nil, width, height, centerRect(cfg.x, cfg.y, 1), cfg)
+	diff := 0
+	for i := 0; i < len(want.Pix); i += 4 {
+		if !bytes.Equal(got.Pix[i:i+4], want.Pix[i:i+4]) {
+			diff++
+		}
+	}
+	if diff > width*height/200 {
+		t.Errorf("farm image differs from render in %d of %d pixels", diff, width*height)
+	}
+}
+
+func TestFarmErrors(t *testing.T) {
+	if _, err := newFarm(64, 64, 0, 1, defaults, time.Second); err == nil {
+		t.Errorf("newFarm with band of 0 rows succeeded, want error")
+	}
+
+	// A worker that cannot render a band ends the run with its error.
+	f, err := newFarm(64, 64, 16, 1, defaults, 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range f.jobs {
+		f.jobs[i].Config = "iter=0"
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	errc := make(chan error, 1)
+	go func() { errc <- work(conn) }()
+	if _, err := f.run(ln); err == nil || !strings.Contains(err.Error(), "iter") {
+		t.Errorf("run = %v, want iter error", err)
+	}
+	if err := <-errc; err == nil {
+		t.Errorf("worker succeeded, want error")
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"sort"
+)
+
+// A rect is the square region of the complex plane shown by an image.
+// It is held exactly, so that deep zooms lose no precision before
+// reaching the backend.
+type rect struct {
+	x, y *big.Float // minimum real and imaginary parts
+	size *big.Float // side length
+}
+
+// newRect returns the square of side 4/2^zoom whose minimum corner is
+// at tile offset (tx, ty), in units of the side, from the minimum
+// corner of the square of side 4 centered on (x, y).
+func newRect(x, y float64, zoom, tx, ty int) rect {
+	prec := uint(64 + zoom)
+	size := new(big.Float).SetPrec(prec).SetMantExp(big.NewFloat(4), -zoom)
+	corner := func(c float64, t int) *big.Float {
+		f := new(big.Float).SetPrec(prec).SetInt64(int64(t))
+		f.Mul(f, size)
+		f.Add(f, big.NewFloat(c))
+		return f.Sub(f, big.NewFloat(2))
+	}
+	return rect{corner(x, tx), corner(y, ty), size}
+}
+
+// centerRect returns the square of side 4/2^zoom centered on (x, y).
+func centerRect(x, y float64, zoom int) rect {
+	r := newRect(x, y, zoom, 0, 0)
+	// Move the corner from x-2 to x-size/2.
+	d := new(big.Float).SetPrec(r.x.Prec()).SetMantExp(r.size, -1)
+	d.Sub(big.NewFloat(2), d)
+	r.x.Add(r.x, d)
+	r.y.Add(r.y, d)
+	return r
+}
+
+// prec returns the number of mantissa bits needed to tell apart
+// adjacent pixels of a width×width image of r.
+func (r rect) prec(width int) uint {
+	exp := r.x.MantExp(nil)
+	if yexp := r.y.MantExp(nil); yexp > exp {
+		exp = yexp
+	}
+	bits := exp - r.size.MantExp(nil) + int(math.Ceil(math.Log2(float64(width)))) + 32
+	if bits < 64 {
+		bits = 64
+	}
+	return uint(bits)
+}
+
+// pixel returns the exact coordinates of the corner of pixel (px, py)
+// of a width×width image of r, to prec bits.
+func (r rect) pixel(px, py, width int, prec uint) (x, y *big.Float) {
+	coord := func(min *big.Float, p int) *big.Float {
+		f := new(big.Float).SetPrec(prec).SetInt64(int64(p))
+		f.Mul(f, r.size)
+		f.Quo(f, new(big.Float).SetInt64(int64(width)))
+		return f.Add(f, min)
+	}
+	return coord(r.x, px), coord(r.y, py)
+}
+
+// A backend computes the sample of each pixel of a width×height image
+// of r, in row order, giving up between rows once done is closed.
+// Only the complex128 backend supports families other than mandelbrot;
+// the others compute the escape count of the pixel's corner: the
+// number of iterations after which its orbit leaves the circle of
+// radius 2, or -1 if it does not.
+type backend func(done <-chan struct{}, samples []sample, width, height int, r rect, cfg config)
+
+// backends maps each value of the precision parameter to its backend.
+var backends = map[string]backend{
+	"complex64":  renderComplex64,
+	"complex128": renderComplex128,
+	"bigfloat":   renderBigFloat,
+	"bigrat":     renderBigRat,
+	"perturb":    renderPerturb,
+}
+
+// cancelled reports whether done is closed. A nil done is never closed.
+func cancelled(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
+
+// precisions returns the names of the backends, in sorted order.
+func precisions() []string {
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func renderComplex128(done <-chan struct{}, samples []sample, width, height int, r rect, cfg config) {
+	xmin, _ := r.x.Float64()
+	ymin, _ := r.y.Float64()
+	size, _ := r.size.Float64()
+	f := families[cfg.family]
+	for py := 0; py < height && !cancelled(done); py++ {
+		y := float64(py)/float64(width)*size + ymin
+		for px := 0; px < width; px++ {
+			x := float64(px)/float64(width)*size + xmin
+			z := complex(x, y)
+			// Image point (px, py) represents complex value z.
+			samples[py*width+px] = f(z, cfg)
+		}
+	}
+}
+
+func renderComplex64(done <-chan struct{}, samples []sample, width, height int, r rect, cfg config) {
+	xmin, _ := r.x.Float32()
+	ymin, _ := r.y.Float32()
+	size, _ := r.size.Float32()
+	for py := 0; py < height && !cancelled(done); py++ {
+		y := float32(py)/float32(width)*size + ymin
+		for px := 0; px < width; px++ {
+			x := float32(px)/float32(width)*size + xmin
+			samples[py*width+px] = mandelbrot64(complex(x, y), cfg)
+		}
+	}
+}
+
+func mandelbrot64(z complex64, cfg config) sample {
+	r := float32(cfg.bailout())
+	var v complex64
+	for n := 0; n < cfg.iterations; n++ {
+		v = v*v + z
+		if re, im := real(v), imag(v); re*re+im*im > r*r {
+			return sample{n: n, abs: math.Hypot(float64(re), float64(im))}
+		}
+	}
+	return bounded
+}
+
+func renderBigFloat(done <-chan struct{}, samples []sample, width, height int, r rect, cfg config) {
+	prec := r.prec(width)
+	for py := 0; py < height && !cancelled(done); py++ {
+		for px := 0; px < width; px++ {
+			x, y := r.pixel(px, py, width, prec)
+			samples[py*width+px] = mandelbrotBigFloat(x, y, prec, cfg)
+		}
+	}
+}
+
+func mandelbrotBigFloat(x, y *big.Float, prec uint, cfg config) sample {
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	vr, vi := newFloat(), newFloat()
+	rr, ii, ri := newFloat(), newFloat(), newFloat()
+	abs := newFloat()
+	r2 := big.NewFloat(cfg.bailout() * cfg.bailout())
+	for n := 0; n < cfg.iterations; n++ {
+		// v = v*v + z
+		rr.Mul(vr, vr)
+		ii.Mul(vi, vi)
+		ri.Mul(vr, vi)
+		vr.Sub(rr, ii).Add(vr, x)
+		vi.Add(ri, ri).Add(vi, y)
+		if abs.Mul(vr, vr).Add(abs, ii.Mul(vi, vi)).Cmp(r2) > 0 {
+			a2, _ := abs.Float64()
+			return sample{n: n, abs: math.Sqrt(a2)}
+		}
+	}
+	return bounded
+}
+
+// renderBigRat uses exact rational arithmetic. The size of the
+// numbers doubles with each iteration, so it is practical only for
+// about a dozen iterations; see maxBigRatIterations.
+func renderBigRat(done <-chan struct{}, samples []sample, width, height int, r rect, cfg config) {
+	prec := r.prec(width)
+	for py := 0; py < height && !cancelled(done); py++ {
+		for px := 0; px < width; px++ {
+			x, y := r.pixel(px, py, width, prec)
+			xr, _ := x.Rat(nil)
+			yr, _ := y.Rat(nil)
+			samples[py*width+px] = mandelbrotBigRat(xr, yr, cfg)
+		}
+	}
+}
+
+func mandelbrotBigRat(x, y *big.Rat, cfg config) sample {
+	vr, vi := new(big.Rat), new(big.Rat)
+	rr, ii, ri := new(big.Rat), new(big.Rat), new(big.Rat)
+	abs := new(big.Rat)
+	r2 := new(big.Rat).SetFloat64(cfg.bailout() * cfg.bailout())
+	for n := 0; n < cfg.iterations; n++ {
+		rr.Mul(vr, vr)
+		ii.Mul(vi, vi)
+		ri.Mul(vr, vi)
+		vr.Sub(rr, ii).Add(vr, x)
+		vi.Add(ri, ri).Add(vi, y)
+		if abs.Mul(vr, vr).Add(abs, ii.Mul(vi, vi)).Cmp(r2) > 0 {
+			a2, _ := abs.Float64()
+			return sample{n: n, abs: math.Sqrt(a2)}
+		}
+	}
+	return bounded
+}
+
+// renderPerturb uses perturbation theory. The orbit Z of a reference
+// point C at the center of r is computed once at high precision; the
+// orbit of each pixel c = C + dc is then tracked as z = Z + d, where
+//
+//	d' = 2·Z·d + d² + dc
+//
+// needs only complex128 arithmetic because d and dc are small.
+// When |z| < |d|, or the reference orbit runs out, the pixel is
+// rebased onto the start of the reference orbit to avoid glitches.
+func renderPerturb(done <-chan struct{}, samples []sample, width, height int, r rect, cfg config) {
+	prec := r.prec(width)
+	half := new(big.Float).SetPrec(prec).Quo(r.size, big.NewFloat(2))
+	cx := new(big.Float).SetPrec(prec).Add(r.x, half)
+	cy := new(big.Float).SetPrec(prec).Add(r.y, half)
+	ref := referenceOrbit(cx, cy, prec, cfg.iterations)
+
+	step, _ := new(big.Float).Quo(r.size, big.NewFloat(float64(width))).Float64()
+	hsize, _ := half.Float64()
+	for py := 0; py < height && !cancelled(done); py++ {
+		dy := float64(py)*step - hsize
+		for px := 0; px < width; px++ {
+			dx := float64(px)*step - hsize
+			samples[py*width+px] = perturb(ref, complex(dx, dy), cfg)
+		}
+	}
+}
+
+// referenceOrbit returns the orbit 0, c, c²+c, ... of c = (x, y),
+// computed at prec bits and rounded to complex128, up to the point at
+// which it escapes.
+func referenceOrbit(x, y *big.Float, prec uint, iterations int) []complex128 {
+	newFloat := func() *big.Float { return new(big.Float).SetPrec(prec) }
+	vr, vi := newFloat(), newFloat()
+	rr, ii, ri := newFloat(), newFloat(), newFloat()
+	orbit := []complex128{0}
+	for n := 0; n < iterations; n++ {
+		rr.Mul(vr, vr)
+		ii.Mul(vi, vi)
+		ri.Mul(vr, vi)
+		vr.Sub(rr, ii).Add(vr, x)
+		vi.Add(ri, ri).Add(vi, y)
+		re, _ := vr.Float64()
+		im, _ := vi.Float64()
+		orbit = append(orbit, complex(re, im))
+		if re*re+im*im > 4 {
+			break
+		}
+	}
+	return orbit
+}
+
+// perturb returns the escape count of the point at offset dc from the
+// reference point whose orbit is ref.
+func perturb(ref []complex128, dc complex128, cfg config) sample {
+	r := cfg.bailout()
+	var d complex128
+	m := 0 // index into ref
+	for n := 0; n < cfg.iterations; n++ {
+		d = 2*ref[m]*d + d*d + dc
+		m++
+		z := ref[m] + d
+		if abs2(z) > r*r {
+			return sample{n: n, abs: math.Sqrt(abs2(z))}
+		}
+		if abs2(z) < abs2(d) || m == len(ref)-1 {
+			d, m = z, 0
+		}
+	}
+	return bounded
+}
+
+func abs2(z complex128) float64 { return real(z)*real(z) + imag(z)*imag(z) }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	tileSize   = 256  // width and height of a tile in pixels
+	maxZoom    = 60   // tile indices must fit in an int64
+	cacheTiles = 1024 // tiles cached, of at most about 256KB each
+)
+
+// maxTileWork bounds the work of rendering a tile, measured as
+// samples × iterations per sample, for each backend, so that no one
+// request keeps a CPU busy for more than about ten seconds. Each
+// iteration of the bigfloat and bigrat backends costs a hundred times
+// that of complex128, and perturb must compute its reference orbit at
+// high precision too.
+var maxTileWork = map[string]int64{
+	"complex64":  1e10,
+	"complex128": 1e10,
+	"perturb":    1e9,
+	"bigfloat":   1e8,
+	"bigrat":     1e8,
+}
+
+// checkTileWork reports an error if a tile rendered with cfg would
+// take more than the work allowed by maxTileWork.
+func checkTileWork(cfg config) error {
+	samples := int64(tileSize*cfg.supersample) * int64(tileSize*cfg.supersample)
+	if max := maxTileWork[cfg.precision]; samples*int64(cfg.iterations) > max {
+		return fmt.Errorf("iter: %d too many for a tile with ss %d and %s precision; want at most %d",
+			cfg.iterations, cfg.supersample, cfg.precision, max/samples)
+	}
+	return nil
+}
+
+// At zoom levels beyond about 40, adjacent pixels are too close for
+// complex128 to tell apart; use the bigfloat or perturb backends.
+
+// A tileServer renders tiles of the fractal on demand.
+//
+// At zoom level z the square of side 4 around the view center is
+// divided into 2^z×2^z tiles; tile (0, 0) is at its top left corner.
+// Tiles outside the square may be requested too.
+type tileServer struct {
+	defaults config
+	cache    *tileCache    // tile key -> renderedTile
+	sema     chan struct{} // counting semaphore limiting concurrent renders
+}
+
+func newTileServer(defaults config) *tileServer {
+	s := &tileServer{
+		defaults: defaults,
+		sema:     make(chan struct{}, runtime.GOMAXPROCS(0)),
+	}
+	s.cache = newTileCache(cacheTiles, s.renderTile)
+	return s
+}
+
+// serve runs a tile server on addr.
+func serve(addr string, defaults config) error {
+	s := newTileServer(defaults)
+	http.HandleFunc("/", s.viewer)
+	http.HandleFunc("/tile/", s.tile)
+	return http.ListenAndServe(addr, nil)
+}
+
+// tileKey returns the cache key of tile (z, x, y) rendered with cfg.
+// The query string is in canonical order, so equal keys
+// denote equal tiles.
+func tileKey(z, x, y int, cfg config) string {
+	return fmt.Sprintf("%d/%d/%d?%s", z, x, y, cfg.values().Encode())
+}
+
+// parseTileKey is the inverse of tileKey.
+func parseTileKey(key string) (z, x, y int, cfg config, err error) {
+	i := strings.IndexByte(key, '?')
+	if i < 0 {
+		return 0, 0, 0, cfg, fmt.Errorf("bad tile key %q", key)
+	}
+	if _, err := fmt.Sscanf(key[:i], "%d/%d/%d", &z, &x, &y); err != nil {
+		return 0, 0, 0, cfg, fmt.Errorf("bad tile key %q: %v", key, err)
+	}
+	q, err := url.ParseQuery(key[i+1:])
+	if err != nil {
+		return 0, 0, 0, cfg, err
+	}
+	cfg, err = parseConfig(q, config{})
+	return z, x, y, cfg, err
+}
+
+// A renderedTile is a PNG-encoded tile and the time its backend took.
+type renderedTile struct {
+	png     []byte
+	elapsed time.Duration
+}
+
+// renderTile is the function behind the tile cache. It returns the
+// tile with the given key, or errCancelled if done is closed first.
+func (s *tileServer) renderTile(key string, done <-chan struct{}) (renderedTile, error) {
+	z, x, y, cfg, err := parseTileKey(key)
+	if err != nil {
+		return renderedTile{}, err
+	}
+	select {
+	case s.sema <- struct{}{}: // acquire token
+	case <-done:
+		return renderedTile{}, errCancelled
+	}
+	defer func() { <-s.sema }()
+
+	img, elapsed, err := render(done, tileSize, tileSize, newRect(cfg.x, cfg.y, z, x, y), cfg)
+	if err != nil {
+		return renderedTile{}, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return renderedTile{}, err
+	}
+	return renderedTile{buf.Bytes(), elapsed}, nil
+}
+
+// tile serves /tile/{z}/{x}/{y}.png. Query parameters override the
+// server's default configuration. The Server-Timing response header
+// reports how long the backend took to render the tile.
+func (s *tileServer) tile(w http.ResponseWriter, r *http.Request) {
+	var z, x, y int
+	path := strings.TrimPrefix(r.URL.Path, "/tile/")
+	if !strings.HasSuffix(path, ".png") {
+		http.NotFound(w, r)
+		return
+	}
+	if _, err := fmt.Sscanf(strings.TrimSuffix(path, ".png"), "%d/%d/%d", &z, &x, &y); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if z < 0 || z > maxZoom {
+		http.Error(w, fmt.Sprintf("zoom %d out of range [0, %d]", z, maxZoom),
+			http.StatusBadRequest)
+		return
+	}
+	cfg, err := parseConfig(r.URL.Query(), s.defaults)
+	if err == nil {
+		err = checkTileWork(cfg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	t, err := s.cache.Get(tileKey(z, x, y, cfg), r.Context().Done())
+	if err == errCancelled {
+		return // the client has gone away
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("Server-Timing", fmt.Sprintf("render;desc=%q;dur=%.3f",
+		cfg.precision, t.elapsed.Seconds()*1000))
+	if _, err := w.Write(t.png); err != nil {
+		log.Print(err)
+	}
+}
+
+// viewer serves a page that displays tiles and lets the user pan by
+// dragging and zoom with the mouse wheel. Its query parameters are
+// passed on to each tile.
+func (s *tileServer) viewer(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, viewerPage, tileSize, maxZoom)
+}
+
+const viewerPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mandelbrot</title>
+<style>
+body { margin: 0; overflow: hidden; background: #000; }
+#view { position: absolute; inset: 0; cursor: grab; }
+#view img { position: absolute; user-select: none; -webkit-user-drag: none; }
+#info { position: absolute; left: 8px; bottom: 8px; color: #ccc; font: 12px monospace; }
+</style>
+</head>
+<body>
+<div id="view"></div>
+<div id="info"></div>
+<script>
+const size = %d, maxZoom = %d;
+const query = location.search;
+const view = document.getElementById("view");
+const info = document.getElementById("info");
+// The view is centered on tile coordinates (tx, ty) at zoom level z.
+let z = 0, tx = 0.5, ty = 0.5;
+
+function draw() {
+	const w = view.clientWidth, h = view.clientHeight;
+	const left = tx*size - w/2, top = ty*size - h/2;
+	view.replaceChildren();
+	for (let y = Math.floor(top/size); y*size < top+h; y++) {
+		for (let x = Math.floor(left/size); x*size < left+w; x++) {
+			const img = document.createElement("img");
+			img.src = "/tile/" + z + "/" + x + "/" + y + ".png" + query;
+			img.style.left = (x*size - left) + "px";
+			img.style.top = (y*size - top) + "px";
+			view.appendChild(img);
+		}
+	}
+	info.textContent = "zoom " + z + " (drag to pan, scroll to zoom)";
+}
+
+let drag = null;
+view.onmousedown = e => { drag = {x: e.clientX, y: e.clientY}; };
+window.onmouseup = () => { drag = null; };
+window.onmousemove = e => {
+	if (!drag) return;
+	tx -= (e.clientX - drag.x) / size;
+	ty -= (e.clientY - drag.y) / size;
+	drag = {x: e.clientX, y: e.clientY};
+	draw();
+};
+view.onwheel = e => {
+	e.preventDefault();
+	if (e.deltaY < 0 && z < maxZoom) { z++; tx *= 2; ty *= 2; }
+	else if (e.deltaY > 0 && z > 0) { z--; tx /= 2; ty /= 2; }
+	draw();
+};
+window.onresize = draw;
+draw();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"sync"
+)
+
+// A preset is a named example expression offered on the index page.
+type preset struct {
+	Name, Expr string
+}
+
+var presets = []preset{
+	{"ripple", "sin(r)/r"},
+	{"egg box", "pow(2,sin(y))*pow(2,sin(x))/12"},
+	{"saddle", "(x*x-y*y)/600"},
+	{"moguls", "sin(x*y/10)/10"},
+	{"decay", "sin(-x)*pow(1.5,-r)"},
+}
+
+// A history records the most recently plotted expressions,
+// newest first, without duplicates.
+type history struct {
+	mu    sync.Mutex // guards exprs
+	exprs []string
+}
+
+const maxHistory = 20
+
+// add moves expr to the front of the history.
+func (h *history) add(expr string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	exprs := []string{expr}
+	for _, e := range h.exprs {
+		if e != expr && len(exprs) < maxHistory {
+			exprs = append(exprs, e)
+		}
+	}
+	h.exprs = exprs
+}
+
+// list returns a copy of the history.
+func (h *history) list() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.exprs...)
+}
+
+var plots history
+
+var indexPage = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>surface{{if .Expr}}: {{.Expr}}{{end}}</title>
+<style>
+body  { font-family: sans-serif; margin: 1em 2em; }
+input[name=expr] { width: 30em; font-family: monospace; }
+.error { color: #b00; }
+code  { background: #eee; }
+</style>
+</head>
+<body>
+<h1>surface</h1>
+<form action="/" method="get">
+  <input name="expr" value="{{.Expr}}" placeholder="sin(r)/r" autofocus>
+  <input type="submit" value="Plot">
+</form>
+<p>Variables: <code>x</code>, <code>y</code> and <code>r</code> (distance from the origin).
+Functions: <code>sin</code>, <code>sqrt</code> and <code>pow</code>.</p>
+<p>Examples:
+{{range .Presets}}<a href="/?expr={{.Expr}}">{{.Name}}</a> {{end}}</p>
+{{if .Error}}
+<p class="error">bad expr: {{.Error}}</p>
+{{else if .Expr}}
+<p><img src="/plot?expr={{.Expr}}" alt="{{.Expr}}"></p>
+<p><a href="/?expr={{.Expr}}">permalink</a> |
+download
+<a href="/plot?expr={{.Expr}}">SVG</a>
+<a href="/mesh?expr={{.Expr}}&amp;format=obj">OBJ</a>
+<a href="/mesh?expr={{.Expr}}&amp;format=stl">STL</a>
+<a href="/mesh?expr={{.Expr}}&amp;format=ply">PLY</a></p>
+{{end}}
+{{if .History}}
+<h2>Previous plots</h2>
+<ol>
+{{range .History}}<li><a href="/?expr={{.}}"><code>{{.}}</code></a></li>
+{{end}}</ol>
+{{end}}
+</body>
+</html>
+`))
+
+// index serves the front page. If the expr parameter is present and
+// valid, the page shows its plot and the expression is added to the
+// history; otherwise the page shows why it was rejected.
+func index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	r.ParseForm()
+	data := struct {
+		Expr    string
+		Error   string
+		Presets []preset
+		History []string
+	}{Expr: r.Form.Get("expr"), Presets: presets}
+	if data.Expr != "" {
+		if _, err := parseAndCheck(data.Expr); err != nil {
+			data.Error = err.Error()
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			plots.add(data.Expr)
+		}
+	}
+	data.History = plots.list()
+	if err := indexPage.Execute(w, data); err != nil {
+		log.Print(err)
+	}
+}
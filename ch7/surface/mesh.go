@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// A vec3 is a point or direction in 3-D space.
+type vec3 struct{ x, y, z float64 }
+
+func (a vec3) sub(b vec3) vec3 { return vec3{a.x - b.x, a.y - b.y, a.z - b.z} }
+func (a vec3) add(b vec3) vec3 { return vec3{a.x + b.x, a.y + b.y, a.z + b.z} }
+
+func (a vec3) cross(b vec3) vec3 {
+	return vec3{a.y*b.z - a.z*b.y, a.z*b.x - a.x*b.z, a.x*b.y - a.y*b.x}
+}
+
+// unit returns a scaled to length 1, or the zero vector if a has no length.
+func (a vec3) unit() vec3 {
+	n := math.Sqrt(a.x*a.x + a.y*a.y + a.z*a.z)
+	if n == 0 {
+		return vec3{}
+	}
+	return vec3{a.x / n, a.y / n, a.z / n}
+}
+
+func finite(v vec3) bool {
+	for _, c := range [...]float64{v.x, v.y, v.z} {
+		if math.IsNaN(c) || math.IsInf(c, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// A mesh is the triangulated surface of a function over the plotting grid.
+// Each grid cell is split into two triangles. Cells with a non-finite
+// corner are left out, so the mesh may have holes.
+type mesh struct {
+	verts   []vec3
+	normals []vec3   // per vertex, averaged over adjacent faces
+	faces   [][3]int // indices into verts, counter-clockwise from above
+}
+
+// newMesh evaluates f at every corner of the (cells+1)×(cells+1) grid
+// used by surface and triangulates the result.
+func newMesh(f func(x, y float64) float64) *mesh {
+	const n = cells + 1
+	m := new(mesh)
+	index := make([]int, n*n) // grid corner -> vertex index, or -1
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			x, y, z := point(f, i, j)
+			v := vec3{x, y, z}
+			if !finite(v) {
+				index[i*n+j] = -1
+				continue
+			}
+			index[i*n+j] = len(m.verts)
+			m.verts = append(m.verts, v)
+		}
+	}
+	m.normals = make([]vec3, len(m.verts))
+	tri := func(a, b, c int) {
+		if a < 0 || b < 0 || c < 0 {
+			return
+		}
+		m.faces = append(m.faces, [3]int{a, b, c})
+		// The unnormalized cross product weights each face's
+		// contribution to its vertex normals by its area.
+		fn := m.verts[b].sub(m.verts[a]).cross(m.verts[c].sub(m.verts[a]))
+		for _, k := range [...]int{a, b, c} {
+			m.normals[k] = m.normals[k].add(fn)
+		}
+	}
+	for i := 0; i < cells; i++ {
+		for j := 0; j < cells; j++ {
+			a := index[i*n+j]
+			b := index[(i+1)*n+j]
+			c := index[(i+1)*n+j+1]
+			d := index[i*n+j+1]
+			tri(a, b, c)
+			tri(a, c, d)
+		}
+	}
+	for k := range m.normals {
+		m.normals[k] = m.normals[k].unit()
+	}
+	return m
+}
+
+// faceNormal returns the unit normal of face f.
+func (m *mesh) faceNormal(f [3]int) vec3 {
+	a, b, c := m.verts[f[0]], m.verts[f[1]], m.verts[f[2]]
+	return b.sub(a).cross(c.sub(a)).unit()
+}
+
+// writeOBJ writes m in Wavefront OBJ format with per-vertex normals.
+func (m *mesh) writeOBJ(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# surface: %d vertices, %d faces\n", len(m.verts), len(m.faces))
+	for _, v := range m.verts {
+		fmt.Fprintf(bw, "v %g %g %g\n", v.x, v.y, v.z)
+	}
+	for _, n := range m.normals {
+		fmt.Fprintf(bw, "vn %g %g %g\n", n.x, n.y, n.z)
+	}
+	for _, f := range m.faces {
+		// OBJ indices are 1-based; vertex k uses normal k.
+		a, b, c := f[0]+1, f[1]+1, f[2]+1
+		fmt.Fprintf(bw, "f %d//%d %d//%d %d//%d\n", a, a, b, b, c, c)
+	}
+	return bw.Flush()
+}
+
+// writeSTL writes m in binary STL format with per-face normals.
+func (m *mesh) writeSTL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var header [80]byte
+	copy(header[:], "binary STL written by gopl.io/ch7/surface")
+	bw.Write(header[:])
+	binary.Write(bw, binary.LittleEndian, uint32(len(m.faces)))
+	for _, f := range m.faces {
+		var rec struct {
+			Normal, A, B, C [3]float32
+			Attr            uint16
+		}
+		rec.Normal = float32s(m.faceNormal(f))
+		rec.A = float32s(m.verts[f[0]])
+		rec.B = float32s(m.verts[f[1]])
+		rec.C = float32s(m.verts[f[2]])
+		if err := binary.Write(bw, binary.LittleEndian, &rec); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func float32s(v vec3) [3]float32 {
+	return [3]float32{float32(v.x), float32(v.y), float32(v.z)}
+}
+
+// writePLY writes m in ASCII PLY format with per-vertex normals.
+func (m *mesh) writePLY(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `ply
+format ascii 1.0
+comment written by gopl.io/ch7/surface
+element vertex %d
+property float x
+property float y
+property float z
+property float nx
+property float ny
+property float nz
+element face %d
+property list uchar int vertex_indices
+end_header
+`, len(m.verts), len(m.faces))
+	for k, v := range m.verts {
+		n := m.normals[k]
+		fmt.Fprintf(bw, "%g %g %g %g %g %g\n", v.x, v.y, v.z, n.x, n.y, n.z)
+	}
+	for _, f := range m.faces {
+		fmt.Fprintf(bw, "3 %d %d %d\n", f[0], f[1], f[2])
+	}
+	return bw.Flush()
+}
+
+// meshFormats maps an export format name to its MIME type and writer.
+var meshFormats = map[string]struct {
+	contentType string
+	write       func(*mesh, io.Writer) error
+}{
+	"obj": {"model/obj", (*mesh).writeOBJ},
+	"stl": {"model/stl", (*mesh).writeSTL},
+	"ply": {"application/x-ply", (*mesh).writePLY},
+}
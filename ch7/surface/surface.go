@@ -2,11 +2,15 @@
 package main
 
 import (
+	"bufio"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"math"
 	"net/http"
+	"os"
+	"strconv"
 
 	"gopl.io/ch7/eval"
 )
@@ -24,42 +28,71 @@ const (
 
 var sin30, cos30 = math.Sin(angle), math.Cos(angle) // sin(30°), cos(30°)
 
-func surface(w io.Writer, f func(x, y float64) float64) {
+// surface writes an SVG rendering of f to w. Polygons are streamed to w
+// through a buffer as they are computed; cells with a corner at which f
+// is NaN or infinite are left out.
+func surface(w io.Writer, f func(x, y float64) float64) error {
 	// The explanation of how the program works requires only basic geometry.
 	// The essence of the program is mapping between three different coordinate
 	// systems.
 
-	svg := fmt.Sprintf("<svg xmlns='http://www.w3.org/2000/svg' "+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "<svg xmlns='http://www.w3.org/2000/svg' "+
 		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
-		"width='%d' height='%d'>", width, height)
+		"width='%d' height='%d'>\n", width, height)
+	var buf []byte // scratch space for one polygon element
 	for i := 0; i < cells; i++ {
 		for j := 0; j < cells; j++ {
-			ax, ay := corner(f, i+1, j)
-			bx, by := corner(f, i, j)
-			cx, cy := corner(f, i, j+1)
-			dx, dy := corner(f, i+1, j+1)
-			svg += fmt.Sprintf("<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
-				ax, ay, bx, by, cx, cy, dx, dy)
+			ax, ay, aok := corner(f, i+1, j)
+			bx, by, bok := corner(f, i, j)
+			cx, cy, cok := corner(f, i, j+1)
+			dx, dy, dok := corner(f, i+1, j+1)
+			if !(aok && bok && cok && dok) {
+				continue
+			}
+			buf = appendPolygon(buf[:0], [...]float64{ax, ay, bx, by, cx, cy, dx, dy})
+			bw.Write(buf)
 		}
 	}
-	svg += fmt.Sprintln("</svg>")
+	bw.WriteString("</svg>\n")
+	return bw.Flush()
+}
 
-	fmt.Fprintln(w, svg)
+// appendPolygon appends to buf an SVG polygon element whose vertices are
+// the successive (x, y) pairs in pts, formatted as by %g.
+func appendPolygon(buf []byte, pts [8]float64) []byte {
+	buf = append(buf, "<polygon points='"...)
+	for k := 0; k < len(pts); k += 2 {
+		if k > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = strconv.AppendFloat(buf, pts[k], 'g', -1, 64)
+		buf = append(buf, ',')
+		buf = strconv.AppendFloat(buf, pts[k+1], 'g', -1, 64)
+	}
+	return append(buf, "'/>\n"...)
 }
 
-// corner returns two values, the coordinates of the corner of the cell.
-func corner(f func(x, y float64) float64, i, j int) (float64, float64) {
+// corner returns the coordinates of the corner of the cell projected onto
+// the SVG canvas, and whether they are finite.
+func corner(f func(x, y float64) float64, i, j int) (sx, sy float64, ok bool) {
+	x, y, z := point(f, i, j)
+
+	// Project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy).
+	sx = width/2 + (x-y)*cos30*xyscale
+	sy = height/2 + (x+y)*sin30*xyscale - z*zscale
+	return sx, sy, finite(vec3{sx, sy, 0})
+}
+
+// point returns the 3-D coordinates of the surface at the corner of cell (i,j).
+func point(f func(x, y float64) float64, i, j int) (x, y, z float64) {
 	// Find point (x,y) at corner of cell (i,j).
-	x := xyrange * (float64(i)/cells - 0.5)
-	y := xyrange * (float64(j)/cells - 0.5)
+	x = xyrange * (float64(i)/cells - 0.5)
+	y = xyrange * (float64(j)/cells - 0.5)
 
 	// Compute surface height z.
-	z := f(x, y)
-
-	// Project (x,y,z) isometrically onto 2-D SVG canvas (sx,sy).
-	sx := width/2 + (x-y)*cos30*xyscale
-	sy := height/2 + (x+y)*sin30*xyscale - z*zscale
-	return sx, sy
+	z = f(x, y)
+	return x, y, z
 }
 
 // func f(x, y float64) float64 {
@@ -87,6 +120,15 @@ func parseAndCheck(s string) (eval.Expr, error) {
 	return expr, nil
 }
 
+// surfaceFunc returns the function of x and y computed by expr.
+func surfaceFunc(expr eval.Expr) func(x, y float64) float64 {
+	return func(x, y float64) float64 {
+		r := math.Hypot(x, y) // distance from (0,0)
+		// return math.Sin(r) / r
+		return expr.Eval(eval.Env{"x": x, "y": y, "r": r})
+	}
+}
+
 func plot(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	expr, err := parseAndCheck(r.Form.Get("expr"))
@@ -95,25 +137,85 @@ func plot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	w.Header().Set("Content-Type", "image/svg+xml")
-	surface(w, func(x, y float64) float64 {
-		r := math.Hypot(x, y) // distance from (0,0)
-		// return math.Sin(r) / r
-		return expr.Eval(eval.Env{"x": x, "y": y, "r": r})
-	})
+	if err := surface(w, surfaceFunc(expr)); err != nil {
+		log.Print(err)
+	}
 }
 
+// exportMesh serves the 3-D mesh of expr in the requested format.
+func exportMesh(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	expr, err := parseAndCheck(r.Form.Get("expr"))
+	if err != nil {
+		http.Error(w, "bad expr: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.Form.Get("format")
+	format, ok := meshFormats[name]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown format %q", name), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=surface.%s", name))
+	if err := format.write(newMesh(surfaceFunc(expr)), w); err != nil {
+		log.Print(err)
+	}
+}
+
+var (
+	exprFlag   = flag.String("expr", "", "write the surface of `expr` to stdout instead of serving")
+	formatFlag = flag.String("format", "svg", "output `format` for -expr: svg, obj, stl or ply")
+)
+
 func main() {
+	flag.Parse()
+	if *exprFlag != "" {
+		if err := export(os.Stdout, *exprFlag, *formatFlag); err != nil {
+			fmt.Fprintf(os.Stderr, "surface: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	http.HandleFunc("/", index)
 	http.HandleFunc("/plot", plot)
+	http.HandleFunc("/mesh", exportMesh)
 	log.Fatal(http.ListenAndServe("localhost:8000", nil))
 }
 
+// export writes the surface of the expression s to w in the named format.
+func export(w io.Writer, s, name string) error {
+	expr, err := parseAndCheck(s)
+	if err != nil {
+		return fmt.Errorf("bad expr: %v", err)
+	}
+	if name == "svg" {
+		return surface(w, surfaceFunc(expr))
+	}
+	format, ok := meshFormats[name]
+	if !ok {
+		return fmt.Errorf("unknown format %q", name)
+	}
+	return format.write(newMesh(surfaceFunc(expr)), w)
+}
+
 /*
 Run:
 $ go run gopl.io/ch7/surface
 
-Open your browser:
+Open your browser at http://localhost:8000/ to enter an expression or pick
+an example, or request a plot directly:
 http://localhost:8000/plot?expr=sin(r)/r
 http://localhost:8000/plot?expr=sin(-x)*pow(1.5,-r)
 http://localhost:8000/plot?expr=pow(2,sin(y))*pow(2,sin(x))/12
 http://localhost:8000/plot?expr=sin(x*y/10)/10
+
+Download the 3-D mesh, for Blender or a slicer:
+http://localhost:8000/mesh?expr=sin(r)/r&format=obj
+http://localhost:8000/mesh?expr=sin(r)/r&format=stl
+http://localhost:8000/mesh?expr=sin(r)/r&format=ply
+
+Or write it from the command line:
+$ go run gopl.io/ch7/surface -expr 'sin(r)/r' -format stl >bin/surface.stl
 */
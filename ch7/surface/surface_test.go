@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func sinc(x, y float64) float64 {
+	r := math.Hypot(x, y)
+	return math.Sin(r) / r
+}
+
+func TestMesh(t *testing.T) {
+	m := newMesh(sinc)
+	// sin(r)/r is NaN at the origin, which is a corner of four cells.
+	const n = cells + 1
+	if got, want := len(m.verts), n*n-1; got != want {
+		t.Errorf("len(verts) = %d, want %d", got, want)
+	}
+	// Each of the four cells around the origin loses the one or two
+	// triangles that touch it: 2 + 1 + 2 + 1.
+	if got, want := len(m.faces), 2*cells*cells-6; got != want {
+		t.Errorf("len(faces) = %d, want %d", got, want)
+	}
+	for k, nv := range m.normals {
+		if nv.z <= 0 {
+			t.Fatalf("normal %d = %v, want upward-facing", k, nv)
+		}
+	}
+}
+
+func TestSTL(t *testing.T) {
+	m := newMesh(sinc)
+	var buf bytes.Buffer
+	if err := m.writeSTL(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if got, want := len(data), 84+50*len(m.faces); got != want {
+		t.Fatalf("STL is %d bytes, want %d", got, want)
+	}
+	if got := binary.LittleEndian.Uint32(data[80:]); int(got) != len(m.faces) {
+		t.Errorf("STL triangle count = %d, want %d", got, len(m.faces))
+	}
+}
+
+func TestSurfaceSkipsNonFinite(t *testing.T) {
+	var buf bytes.Buffer
+	if err := surface(&buf, sinc); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	if strings.Contains(svg, "NaN") || strings.Contains(svg, "Inf") {
+		t.Errorf("surface(sinc) contains non-finite coordinates")
+	}
+	// The four cells around the origin are dropped.
+	if got, want := strings.Count(svg, "<polygon"), cells*cells-4; got != want {
+		t.Errorf("surface(sinc) has %d polygons, want %d", got, want)
+	}
+	if !strings.HasSuffix(svg, "</svg>\n") {
+		t.Errorf("surface(sinc) is not terminated by </svg>")
+	}
+}
+
+func TestAppendPolygon(t *testing.T) {
+	pts := [...]float64{1, 2.5, -3, 4e-7, 5, 6, 7, 8}
+	got := string(appendPolygon(nil, pts))
+	want := fmt.Sprintf("<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
+		pts[0], pts[1], pts[2], pts[3], pts[4], pts[5], pts[6], pts[7])
+	if got != want {
+		t.Errorf("appendPolygon = %q, want %q", got, want)
+	}
+}
+
+// surfaceConcat is the original string-concatenating surface,
+// kept for comparison with the streaming version.
+func surfaceConcat(w io.Writer, f func(x, y float64) float64) {
+	svg := fmt.Sprintf("<svg xmlns='http://www.w3.org/2000/svg' "+
+		"style='stroke: grey; fill: white; stroke-width: 0.7' "+
+		"width='%d' height='%d'>", width, height)
+	for i := 0; i < cells; i++ {
+		for j := 0; j < cells; j++ {
+			ax, ay, _ := corner(f, i+1, j)
+			bx, by, _ := corner(f, i, j)
+			cx, cy, _ := corner(f, i, j+1)
+			dx, dy, _ := corner(f, i+1, j+1)
+			svg += fmt.Sprintf("<polygon points='%g,%g %g,%g %g,%g %g,%g'/>\n",
+				ax, ay, bx, by, cx, cy, dx, dy)
+		}
+	}
+	svg += fmt.Sprintln("</svg>")
+
+	fmt.Fprintln(w, svg)
+}
+
+func BenchmarkSurface(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		surface(ioutil.Discard, sinc)
+	}
+}
+
+func BenchmarkSurfaceConcat(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		surfaceConcat(ioutil.Discard, sinc)
+	}
+}
+
+/*
+$ go test -bench=Surface -run=NONE gopl.io/ch7/surface
+goos: linux
+goarch: amd64
+pkg: gopl.io/ch7/surface
+cpu: Intel(R) Xeon(R) Processor
+BenchmarkSurface       	     100	  12511734 ns/op	    4521 B/op	       6 allocs/op
+BenchmarkSurfaceConcat 	       1	1969056688 ns/op	8426377816 B/op	  105639 allocs/op
+PASS
+*/
+
+func TestIndex(t *testing.T) {
+	for _, test := range []struct {
+		expr   string
+		status int
+		want   string
+	}{
+		{"", http.StatusOK, "Examples:"},
+		{"sin(r)/r", http.StatusOK, `<img src="/plot?expr=sin%28r%29%2fr"`},
+		{"sin(z)", http.StatusBadRequest, "bad expr: undefined variable: z"},
+		{"sin(", http.StatusBadRequest, "bad expr: "},
+	} {
+		rec := httptest.NewRecorder()
+		index(rec, httptest.NewRequest("GET", "/?expr="+url.QueryEscape(test.expr), nil))
+		if rec.Code != test.status {
+			t.Errorf("GET /?expr=%s: status %d, want %d", test.expr, rec.Code, test.status)
+		}
+		if body := rec.Body.String(); !strings.Contains(body, test.want) {
+			t.Errorf("GET /?expr=%s: body does not contain %q", test.expr, test.want)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	var h history
+	for _, e := range []string{"a", "b", "c", "a"} {
+		h.add(e)
+	}
+	if got, want := fmt.Sprint(h.list()), "[a c b]"; got != want {
+		t.Errorf("history = %s, want %s", got, want)
+	}
+	for i := 0; i < 2*maxHistory; i++ {
+		h.add(fmt.Sprint(i))
+	}
+	if got := len(h.list()); got != maxHistory {
+		t.Errorf("len(history) = %d, want %d", got, maxHistory)
+	}
+}